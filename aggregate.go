@@ -0,0 +1,42 @@
+package csp
+
+import "sync"
+
+// AggregateKey identifies a group of violations counted by an AggregatingReporter
+type AggregateKey struct {
+	ViolatedDirective string
+	BlockedURI        string
+}
+
+// AggregatingReporter is a ReportHandler that counts reports by violated directive and blocked URI in memory
+// It is safe for concurrent use.
+type AggregatingReporter struct {
+	mu     sync.Mutex
+	counts map[AggregateKey]int
+}
+
+// NewAggregatingReporter creates an empty AggregatingReporter
+func NewAggregatingReporter() *AggregatingReporter {
+	return &AggregatingReporter{counts: make(map[AggregateKey]int)}
+}
+
+// Report counts a CSP report
+func (a *AggregatingReporter) Report(r Report) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.counts[AggregateKey{r.ViolatedDirective, r.BlockedURI}]++
+	return nil
+}
+
+// Snapshot returns a copy of the current violation counts
+func (a *AggregatingReporter) Snapshot() map[AggregateKey]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := make(map[AggregateKey]int, len(a.counts))
+	for k, v := range a.counts {
+		s[k] = v
+	}
+	return s
+}
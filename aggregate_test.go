@@ -0,0 +1,43 @@
+package csp
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatingReporter(t *testing.T) {
+	a := NewAggregatingReporter()
+
+	reports := []Report{
+		{ViolatedDirective: "script-src 'self'", BlockedURI: "https://cdn.example.com/a.js"},
+		{ViolatedDirective: "script-src 'self'", BlockedURI: "inline"},
+		{ViolatedDirective: "img-src 'self'", BlockedURI: "inline"},
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, r := range reports {
+				require.Nil(t, a.Report(r))
+				a.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := a.Snapshot()
+	assert.EqualValues(t, map[AggregateKey]int{
+		{"script-src 'self'", "https://cdn.example.com/a.js"}: 10,
+		{"script-src 'self'", "inline"}:                       10,
+		{"img-src 'self'", "inline"}:                          10,
+	}, s)
+
+	// Snapshots are not modified by later reports
+	a.Report(reports[0])
+	assert.Equal(t, 10, s[AggregateKey{"script-src 'self'", "https://cdn.example.com/a.js"}])
+}
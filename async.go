@@ -0,0 +1,113 @@
+package csp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// DefaultQueueSize is the default number of reports buffered for asynchronous processing
+const DefaultQueueSize = 256
+
+// Async is a RouteHandler option that processes reports on background workers, responding with 202 Accepted once queued
+// When the queue is full reports are dropped with a 503 Service Unavailable response, or Block waits for queue space.
+// Workers run until Context is cancelled (or for the lifetime of the program where unset), so handlers without
+// a Context should be created once per process. Errors from the report handler are logged.
+type Async struct {
+	Queue   int             // Queue is the number of reports buffered awaiting processing, defaults to DefaultQueueSize
+	Workers int             // Workers is the number of background workers processing reports, defaults to 1
+	Block   bool            // Block waits for space in a full queue rather than dropping reports
+	OnDrop  func(r Report)  // OnDrop is called for each report dropped due to a full queue, eg. to count drops in a metric
+	Context context.Context // Context optionally stops the workers once cancelled, after processing queued reports
+}
+
+// done returns the channel closed when the workers are stopped, nil (never closed) without a Context
+func (a Async) done() <-chan struct{} {
+	if a.Context == nil {
+		return nil
+	}
+	return a.Context.Done()
+}
+
+// asyncReport is a queued report awaiting processing
+type asyncReport struct {
+	ctx context.Context
+	r   *http.Request
+	rep Report
+}
+
+// asyncQueue is the queue of reports awaiting processing, closed once the workers are stopped
+// Reports are only queued under the read lock after checking the workers are not stopped, while the queue is closed
+// under the write lock, so every accepted report is processed.
+type asyncQueue struct {
+	mu      sync.RWMutex
+	reports chan asyncReport
+}
+
+// start creates the report queue and launches the workers, calling handle for each queued report
+func (a Async) start(handle func(ctx context.Context, r *http.Request, rep Report) error) *asyncQueue {
+	size, workers := a.Queue, a.Workers
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	queue := &asyncQueue{reports: make(chan asyncReport, size)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			// Workers drain the queue until it is closed
+			for q := range queue.reports {
+				if err := handle(q.ctx, q.r, q.rep); err != nil {
+					log.Printf("CSP report handler error: %v", err)
+				}
+			}
+		}()
+	}
+
+	if done := a.done(); done != nil {
+		go func() {
+			<-done
+			queue.mu.Lock()
+			close(queue.reports)
+			queue.mu.Unlock()
+		}()
+	}
+
+	return queue
+}
+
+// enqueue queues a report for processing, returning an error where the report was dropped
+func (a Async) enqueue(queue *asyncQueue, q asyncReport) error {
+	queue.mu.RLock()
+	defer queue.mu.RUnlock()
+
+	done := a.done()
+	select {
+	case <-done:
+		return fmt.Errorf("Report queue stopped")
+	default:
+	}
+
+	if a.Block {
+		select {
+		case queue.reports <- q:
+			return nil
+		case <-done:
+			return fmt.Errorf("Report queue stopped")
+		}
+	}
+
+	select {
+	case queue.reports <- q:
+		return nil
+	default:
+		if a.OnDrop != nil {
+			a.OnDrop(q.rep)
+		}
+		return fmt.Errorf("Report queue full")
+	}
+}
@@ -0,0 +1,120 @@
+package csp
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingReporter signals each report received then waits for release
+type blockingReporter struct {
+	received chan Report
+	release  chan struct{}
+}
+
+func (b *blockingReporter) Report(r Report) error {
+	b.received <- r
+	<-b.release
+	return nil
+}
+
+// countingReporter counts reports received, for concurrent use
+type countingReporter struct {
+	n atomic.Int64
+}
+
+func (c *countingReporter) Report(r Report) error {
+	c.n.Add(1)
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	post := func(h http.HandlerFunc) int {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+		h(rw, req)
+		return rw.Code
+	}
+
+	t.Run("Reports processed in background", func(t *testing.T) {
+		br := blockingReporter{make(chan Report, 1), make(chan struct{})}
+		close(br.release)
+		h := RouteHandler(&br, Async{Queue: 1, Workers: 1})
+
+		assert.Equal(t, http.StatusAccepted, post(h))
+
+		select {
+		case r := <-br.received:
+			assert.Equal(t, "http://example.com/signup.html", r.DocumentURI)
+		case <-time.After(time.Second):
+			t.Fatal("report not processed")
+		}
+	})
+
+	t.Run("Reports dropped when queue full", func(t *testing.T) {
+		br := blockingReporter{make(chan Report), make(chan struct{})}
+		defer close(br.release)
+
+		dropped := 0
+		h := RouteHandler(&br, Async{Queue: 1, Workers: 1, OnDrop: func(r Report) { dropped++ }})
+
+		// First report is taken by the worker, the second fills the queue
+		assert.Equal(t, http.StatusAccepted, post(h))
+		<-br.received
+		assert.Equal(t, http.StatusAccepted, post(h))
+
+		assert.Equal(t, http.StatusServiceUnavailable, post(h))
+		assert.Equal(t, 1, dropped)
+	})
+
+	t.Run("Workers stopped by context", func(t *testing.T) {
+		br := blockingReporter{make(chan Report, 1), make(chan struct{})}
+		close(br.release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		h := RouteHandler(&br, Async{Queue: 1, Workers: 1, Block: true, Context: ctx})
+
+		assert.Equal(t, http.StatusAccepted, post(h))
+		<-br.received
+
+		cancel()
+		assert.Equal(t, http.StatusServiceUnavailable, post(h))
+	})
+
+	t.Run("Accepted reports processed after stop", func(t *testing.T) {
+		cr := countingReporter{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h := RouteHandler(&cr, Async{Queue: 4, Workers: 2, Block: true, Context: ctx})
+
+		var accepted atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i == 25 {
+					cancel()
+				}
+				if post(h) == http.StatusAccepted {
+					accepted.Add(1)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		deadline := time.Now().Add(time.Second)
+		for cr.n.Load() != accepted.Load() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, accepted.Load(), cr.n.Load())
+	})
+}
@@ -0,0 +1,82 @@
+package csp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Builder constructs a policy fluently, validating sources as they are added
+type Builder struct {
+	csp         CSP
+	errs        []error
+	unvalidated bool
+}
+
+// NewBuilder creates a builder for an empty policy
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Unvalidated disables validation of sources added to the builder
+func (b *Builder) Unvalidated() *Builder {
+	b.unvalidated = true
+	return b
+}
+
+// Add adds sources to the named directive (eg. "script-src")
+func (b *Builder) Add(directive string, sources ...string) *Builder {
+	directive = strings.ToLower(directive)
+	s := b.csp.sourceList(directive)
+	if s == nil {
+		b.errs = append(b.errs, fmt.Errorf("Unknown directive %s", directive))
+		return b
+	}
+
+	for _, v := range sources {
+		if !b.unvalidated {
+			if err := validateDirectiveSource(directive, v); err != nil {
+				b.errs = append(b.errs, err)
+				continue
+			}
+		}
+		*s = append(*s, v)
+	}
+
+	return b
+}
+
+// ReportTo sets the reporting group for the policy
+func (b *Builder) ReportTo(group string) *Builder {
+	if !b.unvalidated {
+		if err := validateGroup(group); err != nil {
+			b.errs = append(b.errs, err)
+			return b
+		}
+	}
+	b.csp.ReportTo = group
+	return b
+}
+
+// ReportOnly sets the policy into report only mode
+func (b *Builder) ReportOnly() *Builder {
+	b.csp.ReportOnly = true
+	return b
+}
+
+// Build returns the constructed policy, or an error describing any invalid additions
+func (b *Builder) Build() (CSP, error) {
+	if len(b.errs) != 0 {
+		return CSP{}, errors.Join(b.errs...)
+	}
+	return b.csp.clone(), nil
+}
+
+// MustBuild returns the constructed policy, panicking on any invalid additions
+func (b *Builder) MustBuild() CSP {
+	c, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,60 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+
+	t.Run("Build valid policy", func(t *testing.T) {
+		c, err := NewBuilder().
+			Add(defaultSrc, SourceNone).
+			Add(scriptSrc, SourceSelf).
+			Add(connectSrc, SourceSelf).
+			Add(imgSrc, SourceSelf).
+			Add(styleSrc, SourceSelf).
+			Build()
+		require.Nil(t, err)
+		assert.EqualValues(t, Default(), c)
+	})
+
+	t.Run("Build with malformed source", func(t *testing.T) {
+		_, err := NewBuilder().
+			Add(defaultSrc, SourceSelf).
+			Add(scriptSrc, "'self").
+			Build()
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "script-src")
+	})
+
+	t.Run("Build with invalid token", func(t *testing.T) {
+		_, err := NewBuilder().Add(requireSRIFor, "bogus").Build()
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "require-sri-for")
+
+		c, err := NewBuilder().Add(requireSRIFor, "script").Build()
+		require.Nil(t, err)
+		assert.EqualValues(t, []string{"script"}, c.RequireSRIFor)
+	})
+
+	t.Run("Build with unknown directive", func(t *testing.T) {
+		_, err := NewBuilder().Add("script-source", SourceSelf).Build()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Build unvalidated", func(t *testing.T) {
+		c, err := NewBuilder().Unvalidated().Add(scriptSrc, "\"self\"").Build()
+		require.Nil(t, err)
+		assert.EqualValues(t, NewSourceList("\"self\""), c.ScriptSrc)
+	})
+
+	t.Run("MustBuild panics on malformed source", func(t *testing.T) {
+		assert.Panics(t, func() {
+			NewBuilder().Add(scriptSrc, "\"self\"").MustBuild()
+		})
+	})
+
+}
@@ -0,0 +1,75 @@
+package csp
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Client address forwarding headers
+const (
+	HeaderForwardedFor = "X-Forwarded-For"
+	HeaderRealIP       = "X-Real-IP"
+)
+
+// TrustedProxies lists proxy networks trusted to supply the client address
+// via the X-Forwarded-For or X-Real-IP headers
+type TrustedProxies []*net.IPNet
+
+// NewTrustedProxies parses a list of CIDRs (eg. 10.0.0.0/8) into a TrustedProxies list
+func NewTrustedProxies(cidrs ...string) (TrustedProxies, error) {
+	t := make(TrustedProxies, len(cidrs))
+	for i, v := range cidrs {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		t[i] = n
+	}
+	return t, nil
+}
+
+// trusted checks whether an address is within a trusted proxy network
+func (t TrustedProxies) trusted(ip net.IP) bool {
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP fetches the client address for a request
+// Forwarding headers are only used where the immediate peer is a trusted proxy, in which case
+// the X-Forwarded-For chain (across all header lines) is walked from the nearest hop to the first untrusted address.
+func (t TrustedProxies) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !t.trusted(peer) {
+		return peer
+	}
+
+	if xff := strings.Join(r.Header.Values(HeaderForwardedFor), ","); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			peer = ip
+			if !t.trusted(ip) {
+				break
+			}
+		}
+		return peer
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(HeaderRealIP))); ip != nil {
+		return ip
+	}
+
+	return peer
+}
@@ -0,0 +1,57 @@
+package csp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := NewTrustedProxies("10.0.0.0/8")
+	require.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		realIP string
+		ip     string
+	}{
+		{"No proxy", "192.0.2.1:1234", "", "", "192.0.2.1"},
+		{"Untrusted peer is not forwarded", "192.0.2.1:1234", "198.51.100.1", "", "192.0.2.1"},
+		{"Trusted peer is forwarded", "10.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"Trusted chain is walked", "10.0.0.1:1234", "198.51.100.1, 203.0.113.1, 10.0.0.2", "", "203.0.113.1"},
+		{"Trusted peer real IP", "10.0.0.1:1234", "", "198.51.100.1", "198.51.100.1"},
+	}
+
+	for _, v := range tests {
+		t.Run(v.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.RemoteAddr = v.remote
+			if v.xff != "" {
+				req.Header.Set(HeaderForwardedFor, v.xff)
+			}
+			if v.realIP != "" {
+				req.Header.Set(HeaderRealIP, v.realIP)
+			}
+
+			assert.Equal(t, v.ip, proxies.ClientIP(req).String())
+		})
+	}
+
+	t.Run("Forwarded header lines are joined", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Add(HeaderForwardedFor, "6.6.6.6")
+		req.Header.Add(HeaderForwardedFor, "203.0.113.9")
+
+		assert.Equal(t, "203.0.113.9", proxies.ClientIP(req).String())
+	})
+
+	t.Run("Invalid CIDR", func(t *testing.T) {
+		_, err := NewTrustedProxies("10.0.0.0")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,143 @@
+package csp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// config is the serialized form of a CSP configuration
+type config struct {
+	Extends         string        `json:"extends,omitempty"`
+	ReportOnly      *bool         `json:"report-only,omitempty"`
+	Nonce           *bool         `json:"nonce,omitempty"`
+	NonceDirectives []string      `json:"nonce-directives,omitempty"`
+	HTMLOnly        *bool         `json:"html-only,omitempty"`
+	SkipStatus      []int         `json:"skip-status,omitempty"`
+	ReportingGroups []configGroup `json:"reporting-groups,omitempty"`
+	Policy          string        `json:"policy"`
+}
+
+// configGroup is the serialized form of a ReportingGroup
+type configGroup struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	MaxAge   int    `json:"max-age,omitempty"`
+}
+
+// MarshalConfig marshals a CSP configuration to JSON
+// Unlike MarshalText this includes handler settings such as the report only flag, nonces and reporting groups,
+// so configurations round-trip fully
+func (c *CSP) MarshalConfig() ([]byte, error) {
+	txt, err := c.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config{Policy: string(txt), NonceDirectives: c.NonceDirectives, SkipStatus: c.SkipStatus}
+	if c.ReportOnly {
+		cfg.ReportOnly = &c.ReportOnly
+	}
+	if c.Nonce {
+		cfg.Nonce = &c.Nonce
+	}
+	if c.HTMLOnly {
+		cfg.HTMLOnly = &c.HTMLOnly
+	}
+	for _, g := range c.ReportingGroups {
+		cfg.ReportingGroups = append(cfg.ReportingGroups, configGroup{g.Name, g.Endpoint, g.MaxAge})
+	}
+
+	return json.Marshal(cfg)
+}
+
+// UnmarshalConfig un-marshals a CSP configuration from JSON as produced by MarshalConfig
+func (c *CSP) UnmarshalConfig(data []byte) error {
+	cfg := config{}
+	err := json.Unmarshal(data, &cfg)
+	if err != nil {
+		return err
+	}
+
+	return c.fromConfig(cfg)
+}
+
+// fromConfig loads a CSP configuration from its serialized form
+func (c *CSP) fromConfig(cfg config) error {
+	err := c.UnmarshalText([]byte(cfg.Policy))
+	if err != nil {
+		return err
+	}
+	c.ReportOnly = cfg.ReportOnly != nil && *cfg.ReportOnly
+	c.Nonce = cfg.Nonce != nil && *cfg.Nonce
+	c.HTMLOnly = cfg.HTMLOnly != nil && *cfg.HTMLOnly
+	c.NonceDirectives = cfg.NonceDirectives
+	c.SkipStatus = cfg.SkipStatus
+	c.ReportingGroups = nil
+	for _, g := range cfg.ReportingGroups {
+		c.ReportingGroups = append(c.ReportingGroups, ReportingGroup{g.Name, g.Endpoint, g.MaxAge})
+	}
+
+	return nil
+}
+
+// LoadWithExtends loads a CSP configuration file from fsys, resolving any chain of "extends" references
+// Extended files are resolved relative to the referencing file, and each configuration overrides the directives
+// and settings it sets, inheriting the rest from the configuration it extends (see WithDefaults).
+// Handler settings (report only, nonce, HTML only and skipped statuses) are likewise inherited unless set.
+// Cyclic references return an error.
+func LoadWithExtends(fsys fs.FS, name string) (CSP, error) {
+	return loadWithExtends(fsys, name, make(map[string]bool))
+}
+
+func loadWithExtends(fsys fs.FS, name string, seen map[string]bool) (CSP, error) {
+	if seen[name] {
+		return CSP{}, fmt.Errorf("Cyclic extends of %s", name)
+	}
+	seen[name] = true
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return CSP{}, err
+	}
+
+	cfg := config{}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return CSP{}, fmt.Errorf("Error parsing %s: %s", name, err)
+	}
+
+	c := CSP{}
+	err = c.fromConfig(cfg)
+	if err != nil {
+		return CSP{}, err
+	}
+
+	if cfg.Extends == "" {
+		return c, nil
+	}
+
+	base, err := loadWithExtends(fsys, path.Join(path.Dir(name), cfg.Extends), seen)
+	if err != nil {
+		return CSP{}, err
+	}
+
+	c = c.WithDefaults(base)
+	if cfg.ReportOnly == nil {
+		c.ReportOnly = base.ReportOnly
+	}
+	if cfg.Nonce == nil {
+		c.Nonce = base.Nonce
+	}
+	if cfg.HTMLOnly == nil {
+		c.HTMLOnly = base.HTMLOnly
+	}
+	if cfg.NonceDirectives == nil {
+		c.NonceDirectives = base.NonceDirectives
+	}
+	if cfg.SkipStatus == nil {
+		c.SkipStatus = base.SkipStatus
+	}
+	return c, nil
+}
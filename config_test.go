@@ -0,0 +1,68 @@
+package csp
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWithExtends(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.json":   {Data: []byte(`{"policy": "default-src 'none'; script-src 'self'; report-to base"}`)},
+		"strict.json": {Data: []byte(`{"report-only": true, "policy": "default-src 'self'; script-src 'self' cdn.example.com; img-src *"}`)},
+		"tight.json":  {Data: []byte(`{"extends": "strict.json", "policy": "script-src 'self'; img-src 'self'"}`)},
+		"env/child.json": {Data: []byte(`{"extends": "../base.json", "report-only": true,
+			"policy": "img-src 'self'; script-src cdn.example.com; report-to child"}`)},
+		"nonce.json":       {Data: []byte(`{"nonce": true, "nonce-directives": ["script-src", "style-src"], "skip-status": [304], "policy": "script-src 'strict-dynamic'"}`)},
+		"nonce-child.json": {Data: []byte(`{"extends": "nonce.json", "policy": "style-src 'self'"}`)},
+		"a.json":           {Data: []byte(`{"extends": "b.json", "policy": "default-src 'self'"}`)},
+		"b.json":           {Data: []byte(`{"extends": "a.json", "policy": "default-src 'self'"}`)},
+	}
+
+	t.Run("Load base policy", func(t *testing.T) {
+		c, err := LoadWithExtends(fsys, "base.json")
+		require.Nil(t, err)
+
+		txt, _ := c.MarshalText()
+		assert.EqualValues(t, "default-src 'none'; script-src 'self'; report-to base", string(txt))
+	})
+
+	t.Run("Load child extending base", func(t *testing.T) {
+		c, err := LoadWithExtends(fsys, "env/child.json")
+		require.Nil(t, err)
+
+		txt, _ := c.MarshalText()
+		assert.EqualValues(t, "default-src 'none'; img-src 'self'; script-src cdn.example.com; report-to child", string(txt))
+		assert.True(t, c.ReportOnly)
+	})
+
+	t.Run("Child overrides inherited directives", func(t *testing.T) {
+		c, err := LoadWithExtends(fsys, "tight.json")
+		require.Nil(t, err)
+
+		txt, _ := c.MarshalText()
+		assert.EqualValues(t, "default-src 'self'; img-src 'self'; script-src 'self'", string(txt))
+		assert.True(t, c.ReportOnly)
+	})
+
+	t.Run("Child inherits handler settings", func(t *testing.T) {
+		c, err := LoadWithExtends(fsys, "nonce-child.json")
+		require.Nil(t, err)
+
+		assert.True(t, c.Nonce)
+		assert.EqualValues(t, []string{scriptSrc, styleSrc}, c.NonceDirectives)
+		assert.EqualValues(t, []int{304}, c.SkipStatus)
+	})
+
+	t.Run("Cyclic extends", func(t *testing.T) {
+		_, err := LoadWithExtends(fsys, "a.json")
+		assert.EqualError(t, err, "Cyclic extends of a.json")
+	})
+
+	t.Run("Missing extends", func(t *testing.T) {
+		_, err := LoadWithExtends(fsys, "missing.json")
+		assert.NotNil(t, err)
+	})
+}
@@ -1,9 +1,13 @@
 package csp
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 // CSP standard source types
@@ -11,6 +15,30 @@ const (
 	SourceNone = "'none'"
 	SourceSelf = "'self'"
 	SourceAny  = "*"
+
+	SourceUnsafeInline  = "'unsafe-inline'"
+	SourceUnsafeEval    = "'unsafe-eval'"
+	SourceUnsafeHashes  = "'unsafe-hashes'"
+	SourceStrictDynamic = "'strict-dynamic'"
+	SourceReportSample  = "'report-sample'"
+)
+
+// WebRTC directive values
+const (
+	WebRTCAllow = "'allow'"
+	WebRTCBlock = "'block'"
+)
+
+// CSP scheme sources
+const (
+	SchemeHTTP        = "http:"
+	SchemeHTTPS       = "https:"
+	SchemeWS          = "ws:"
+	SchemeWSS         = "wss:"
+	SchemeData        = "data:"
+	SchemeBlob        = "blob:"
+	SchemeMediaStream = "mediastream:"
+	SchemeFilesystem  = "filesystem:"
 )
 
 // Fetch directives
@@ -25,17 +53,40 @@ const (
 	manifestSrc = "manifest-src"
 	mediaSrc    = "media-src"
 	objectSrc   = "object-src"
+	prefetchSrc = "prefetch-src"
 	scriptSrc   = "script-src"
 	styleSrc    = "style-src"
 	workerSrc   = "worker-src"
 
+	// Document directives
+	baseURI       = "base-uri"
+	pluginTypes   = "plugin-types"
+	requireSRIFor = "require-sri-for"
+
+	// Navigation directives
+	navigateTo = "navigate-to"
+
+	// WebRTC
+	webRTC = "webrtc"
+
+	// Trusted types
+	// https://w3c.github.io/trusted-types/dist/spec/#integration-with-content-security-policy
+	requireTrustedTypesFor = "require-trusted-types-for"
+	trustedTypes           = "trusted-types"
+
 	// Reporting
-	reportTo = "report-to"
+	reportURI = "report-uri"
+	reportTo  = "report-to"
 )
 
 // CSP Configuration Structure
 type CSP struct {
-	ReportOnly bool // ReportOnly sets CSP into report only mode
+	ReportOnly bool  // ReportOnly sets CSP into report only mode
+	Nonce      bool  // Nonce generates a nonce per request in Handler, added to NonceDirectives and available via NonceFromContext
+	HTMLOnly   bool  // HTMLOnly attaches headers in Handler only to text/html responses
+	SkipStatus []int // SkipStatus lists response status codes (eg. 304) for which Handler omits headers
+
+	NonceDirectives []string // NonceDirectives lists the fetch directives Handler adds the nonce to, script-src where unset
 
 	// Fetch directives
 	ChildSrc    SourceList
@@ -47,12 +98,35 @@ type CSP struct {
 	ManifestSrc SourceList
 	MediaSrc    SourceList
 	ObjectSrc   SourceList
+	PrefetchSrc SourceList // PrefetchSrc is deprecated with variable browser support
 	ScriptSrc   SourceList
 	StyleSrc    SourceList
 	WorkerSrc   SourceList
 
+	// Document directives
+	BaseURI       SourceList
+	PluginTypes   []string // PluginTypes sets allowed plugin MIME types, eg. application/pdf (deprecated)
+	RequireSRIFor []string // RequireSRIFor requires subresource integrity for script and/or style resources
+
+	// Navigation directives
+	NavigateTo SourceList // NavigateTo is experimental with limited browser support
+
+	// WebRTC
+	WebRTC string // WebRTC controls RTCPeerConnection use, either WebRTCAllow or WebRTCBlock
+
+	// Trusted types
+	RequireTrustedTypesFor []string // RequireTrustedTypesFor sets the sinks requiring trusted types, eg. 'script'
+	TrustedTypes           []string // TrustedTypes sets allowed policy names, an empty non-nil list allows no policies
+
 	// Reporting
-	ReportTo string
+	ReportURI string // ReportURI sets the deprecated report-uri endpoint, still required by browsers without report-to support
+	ReportTo  string // ReportTo names the reporting endpoint group, DualHandler policies may each use a different group
+
+	// ReportingGroups are emitted by Handler in the Report-To header, see AddReportingGroup
+	ReportingGroups []ReportingGroup
+
+	// Extra holds directives not otherwise supported, these are preserved when re-marshaling
+	Extra map[string]SourceList
 }
 
 // Default generates a default / basic CSP policy with
@@ -67,141 +141,687 @@ func Default() CSP {
 	}
 }
 
-// cspHandler wraps a CSP configuration providing an http.Handler interface
-// and wrapping an underlying handler
-type cspHandler struct {
-	*CSP
-	h http.Handler
+// Strict generates the strict nonce based policy recommended by https://csp.withgoogle.com/docs/strict-csp.html
+// with 'strict-dynamic' scripts, object-src and base-uri set to 'none', and trusted types required for scripts.
+//
+// Handler generates a nonce for each request which must be applied to every script tag (see NonceFromContext),
+// and 'strict-dynamic' allows scripts loaded by nonced scripts to execute. This removes the need to maintain
+// host allowlists, however every inline and external script must carry the nonce, inline event handlers
+// and javascript: URLs are blocked, and trusted types requires DOM XSS sinks to be routed through trusted types
+// policies which may not suit legacy applications. Marshaled without Handler the policy has no nonce and blocks all scripts.
+func Strict() CSP {
+	return CSP{
+		Nonce:                  true,
+		ScriptSrc:              NewSourceList(SourceStrictDynamic),
+		ObjectSrc:              NewSourceList(SourceNone),
+		BaseURI:                NewSourceList(SourceNone),
+		RequireTrustedTypesFor: []string{"'script'"},
+	}
+}
+
+// directive binds a directive name to the source list it is stored in
+type directive struct {
+	name    string
+	sources *SourceList
 }
 
-// ServeHTTP is an http.Handler instance that attaches CSP headers to all requests
-func (c *cspHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	key := HeaderPolicy
-	if c.ReportOnly {
-		key = HeaderReportOnly
+// directives returns the source list directives of a policy in marshal order
+func (c *CSP) directives() []directive {
+	return []directive{
+		{defaultSrc, &c.DefaultSrc},
+		{childSrc, &c.ChildSrc},
+		{connectSrc, &c.ConnectSrc},
+		{fontSrc, &c.FontSrc},
+		{frameSrc, &c.FrameSrc},
+		{imgSrc, &c.ImgSrc},
+		{manifestSrc, &c.ManifestSrc},
+		{mediaSrc, &c.MediaSrc},
+		{objectSrc, &c.ObjectSrc},
+		{prefetchSrc, &c.PrefetchSrc},
+		{scriptSrc, &c.ScriptSrc},
+		{styleSrc, &c.StyleSrc},
+		{workerSrc, &c.WorkerSrc},
+		{baseURI, &c.BaseURI},
+		{pluginTypes, (*SourceList)(&c.PluginTypes)},
+		{requireSRIFor, (*SourceList)(&c.RequireSRIFor)},
+		{navigateTo, &c.NavigateTo},
+		{requireTrustedTypesFor, (*SourceList)(&c.RequireTrustedTypesFor)},
+		{trustedTypes, (*SourceList)(&c.TrustedTypes)},
 	}
+}
 
-	val, err := c.MarshalText()
-	if err != nil {
-		return
+// valueless directives are meaningful when set with no sources
+var valueless = map[string]bool{
+	trustedTypes: true,
+}
+
+// sourceList fetches the source list for a named directive (case insensitively), returning nil for unknown directives
+func (c *CSP) sourceList(name string) *SourceList {
+	name = strings.ToLower(name)
+	for _, d := range c.directives() {
+		if d.name == name {
+			return d.sources
+		}
 	}
+	return nil
+}
 
-	w.Header().Set(key, string(val))
+// AddSource appends sources to the named directive (eg. "script-src")
+// This returns an error for unknown or non source list directives.
+func (c *CSP) AddSource(directive string, sources ...string) error {
+	s := c.sourceList(directive)
+	if s == nil {
+		return fmt.Errorf("Unknown directive %s", directive)
+	}
+	*s = append(*s, sources...)
+	return nil
+}
 
-	c.h.ServeHTTP(w, r)
+// RemoveSource removes all occurrences of a source from the named directive
+// This returns an error for unknown or non source list directives.
+func (c *CSP) RemoveSource(directive string, source string) error {
+	s := c.sourceList(directive)
+	if s == nil {
+		return fmt.Errorf("Unknown directive %s", directive)
+	}
+	*s = s.Remove(source)
+	return nil
 }
 
-// Handler wraps an http.Handler in a CSP instance
-// All handlers from a given CSP instance will refer to that instance
-func (c *CSP) Handler(h http.Handler) http.Handler {
-	return &cspHandler{c, h}
+// Allows checks whether the named directive contains the provided source
+// This returns false for unknown or non source list directives.
+func (c *CSP) Allows(directive string, source string) bool {
+	s := c.sourceList(directive)
+	return s != nil && s.Contains(source)
 }
 
-// MarshalText marshals a CSP policy to text
-func (c *CSP) MarshalText() ([]byte, error) {
-	policies := make([]string, 0)
+// Has checks whether a directive is set, either with sources or as a valueless directive (eg. upgrade-insecure-requests)
+func (c CSP) Has(directive string) bool {
+	name := strings.ToLower(directive)
+	if s := c.sourceList(name); s != nil {
+		return len(*s) != 0 || (*s != nil && valueless[name])
+	}
 
-	if len(c.DefaultSrc) != 0 {
-		txt, _ := c.DefaultSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", defaultSrc, txt))
+	switch name {
+	case webRTC:
+		return c.WebRTC != ""
+	case reportURI:
+		return c.ReportURI != ""
+	case reportTo:
+		return c.ReportTo != ""
 	}
-	if len(c.ChildSrc) != 0 {
-		txt, _ := c.ChildSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", childSrc, txt))
+
+	_, ok := c.Extra[name]
+	return ok
+}
+
+// EnableReportSample adds 'report-sample' to the named directives (eg. "script-src"), so violation reports include a sample of the violating code
+// This returns an error for unknown or non source list directives.
+func (c *CSP) EnableReportSample(directives ...string) error {
+	for _, d := range directives {
+		s := c.sourceList(d)
+		if s == nil {
+			return fmt.Errorf("Unknown directive %s", d)
+		}
+		if !s.Contains(SourceReportSample) {
+			*s = append(*s, SourceReportSample)
+		}
 	}
-	if len(c.ConnectSrc) != 0 {
-		txt, _ := c.ConnectSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", connectSrc, txt))
+	return nil
+}
+
+// AddNonce appends a 'nonce-<value>' source to each named fetch directive, for nonces shared across script and style elements
+// Source lists are copied rather than appended in place, so this may be applied to a per-request copy of a policy
+// (eg. before WithPolicy) without modifying the shared configuration. Unset directives are set to their effective
+// sources (see Effective) plus the nonce. Handler applies its nonce to NonceDirectives.
+func (c *CSP) AddNonce(nonce string, directives ...string) error {
+	if !base64Pattern.MatchString(nonce) {
+		return fmt.Errorf("Invalid nonce %q (expected base64)", nonce)
 	}
-	if len(c.FontSrc) != 0 {
-		txt, _ := c.FontSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", fontSrc, txt))
+
+	return c.addNonceSource("'nonce-"+nonce+"'", directives, false)
+}
+
+// addNonceSource adds a nonce source to the named fetch directives where not already present, prepending or appending
+// to a copy of each source list. Element and attribute directives (eg. script-src-elem) are held in Extra.
+func (c *CSP) addNonceSource(source string, directives []string, prepend bool) error {
+	for _, d := range directives {
+		if err := validateNonceDirective(d); err != nil {
+			return err
+		}
 	}
-	if len(c.FrameSrc) != 0 {
-		txt, _ := c.FrameSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", frameSrc, txt))
+
+	for _, d := range directives {
+		// Unset directives start from the sources they fall back to, so adding the nonce does not replace them
+		s := c.lookup(d)
+		if len(s) == 0 {
+			s = c.Effective(d)
+		}
+		if s.Contains(source) {
+			continue
+		}
+
+		if prepend {
+			s = append(SourceList{source}, s...)
+		} else {
+			s = append(s[:len(s):len(s)], source)
+		}
+
+		if l := c.sourceList(d); l != nil {
+			*l = s
+		} else {
+			if c.Extra == nil {
+				c.Extra = make(map[string]SourceList)
+			}
+			c.Extra[d] = s
+		}
 	}
-	if len(c.ImgSrc) != 0 {
-		txt, _ := c.ImgSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", imgSrc, txt))
+	return nil
+}
+
+// MapSources returns a copy of the policy with f applied to every source (including directives in Extra),
+// for bulk rewriting such as migrating hosts. Sources for which f returns an empty string are dropped.
+// Source directives with every source dropped are set to 'none' rather than falling back to a possibly broader
+// default-src, while other directives (eg. require-sri-for) are removed as they do not accept 'none'.
+func (c CSP) MapSources(f func(directive, source string) string) CSP {
+	n := c.clone()
+
+	apply := func(name string, sources SourceList) SourceList {
+		if sources == nil {
+			return nil
+		}
+		mapped := make(SourceList, 0, len(sources))
+		for _, s := range sources {
+			if m := f(name, s); m != "" {
+				mapped = append(mapped, m)
+			}
+		}
+		if len(sources) != 0 && len(mapped) == 0 && !valueless[name] {
+			if acceptsNone(name) {
+				return SourceList{SourceNone}
+			}
+			return nil
+		}
+		return mapped
+	}
+
+	for _, d := range n.directives() {
+		*d.sources = apply(d.name, *d.sources)
+	}
+	for k, v := range n.Extra {
+		n.Extra[k] = apply(k, v)
+	}
+
+	return n
+}
+
+// acceptsNone checks whether a directive takes a source list for which 'none' blocks all sources
+func acceptsNone(directive string) bool {
+	if _, ok := fetchFallbacks[directive]; ok {
+		return true
+	}
+	switch directive {
+	case defaultSrc, baseURI, navigateTo, "frame-ancestors", "form-action":
+		return true
+	}
+	return false
+}
+
+// Hosts returns the sorted, deduplicated host sources across all directives (eg. https://cdn.example.com),
+// excluding keywords, nonces, hashes, scheme sources and wildcards. Directives in Extra are not included.
+func (c CSP) Hosts() []string {
+	hosts := make([]string, 0)
+	for _, d := range c.directives() {
+		if nameDirectives[d.name] || directiveTokens[d.name] != nil {
+			continue
+		}
+		for _, s := range *d.sources {
+			if s == SourceAny || s == NoncePlaceholder || strings.HasPrefix(s, "'") || strings.HasSuffix(s, ":") {
+				continue
+			}
+			if !SourceList(hosts).Contains(s) {
+				hosts = append(hosts, s)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// WithReporting sets both the report-uri endpoint and report-to group, so reports are sent by
+// browsers that only support the deprecated report-uri as well as those supporting report-to.
+func (c *CSP) WithReporting(uri string, group string) {
+	c.ReportURI = uri
+	c.ReportTo = group
+}
+
+// StripReporting removes the report-uri endpoint, report-to group and reporting groups from the policy,
+// for proxies forwarding policies without exposing internal report endpoints
+func (c *CSP) StripReporting() {
+	c.ReportURI = ""
+	c.ReportTo = ""
+	c.ReportingGroups = nil
+	delete(c.Extra, reportURI)
+	delete(c.Extra, reportTo)
+}
+
+// StrictDynamic adds 'strict-dynamic' to script-src, allowing scripts loaded by trusted (nonce or hash) scripts to execute
+// Note that browsers supporting 'strict-dynamic' ignore host sources and 'self' in script-src.
+func (c *CSP) StrictDynamic() {
+	if !c.ScriptSrc.Contains(SourceStrictDynamic) {
+		c.ScriptSrc = append(c.ScriptSrc, SourceStrictDynamic)
+	}
+}
+
+// AsEnforced returns a copy of the policy with ReportOnly cleared, leaving the original unmodified
+func (c CSP) AsEnforced() CSP {
+	n := c.clone()
+	n.ReportOnly = false
+	return n
+}
+
+// AsReportOnly returns a copy of the policy with ReportOnly set, leaving the original unmodified
+func (c CSP) AsReportOnly() CSP {
+	n := c.clone()
+	n.ReportOnly = true
+	return n
+}
+
+// Reset clears all directives and settings, allowing a policy struct to be reused
+// Handlers created with Handler hold a copy of the policy, so are unaffected and continue to serve the previous policy.
+// To reload the policy served by a handler use NewReloadHandler and Swap.
+func (c *CSP) Reset() {
+	*c = CSP{}
+}
+
+// clone returns a deep copy of a policy
+func (c CSP) clone() CSP {
+	n := c
+
+	for _, d := range n.directives() {
+		if *d.sources != nil {
+			*d.sources = append(SourceList{}, *d.sources...)
+		}
+	}
+
+	if c.SkipStatus != nil {
+		n.SkipStatus = append([]int{}, c.SkipStatus...)
+	}
+	if c.NonceDirectives != nil {
+		n.NonceDirectives = append([]string{}, c.NonceDirectives...)
+	}
+	if c.ReportingGroups != nil {
+		n.ReportingGroups = append([]ReportingGroup{}, c.ReportingGroups...)
+	}
+
+	if c.Extra != nil {
+		n.Extra = make(map[string]SourceList, len(c.Extra))
+		for k, v := range c.Extra {
+			n.Extra[k] = append(SourceList{}, v...)
+		}
+	}
+
+	return n
+}
+
+// entry is a single marshaled directive
+type entry struct {
+	name  string
+	value string
+}
+
+// String formats an entry as it appears in a policy
+func (e entry) String() string {
+	if e.value == "" {
+		return e.name
 	}
-	if len(c.ManifestSrc) != 0 {
-		txt, _ := c.ManifestSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", manifestSrc, txt))
+	return fmt.Sprintf("%s %s", e.name, e.value)
+}
+
+// entries marshals the set directives of a policy, in marshal order
+func (c *CSP) entries() []entry {
+	entries := make([]entry, 0)
+
+	for _, d := range c.directives() {
+		if len(*d.sources) == 0 {
+			if *d.sources != nil && valueless[d.name] {
+				entries = append(entries, entry{d.name, ""})
+			}
+			continue
+		}
+		txt, _ := d.sources.MarshalText()
+		entries = append(entries, entry{d.name, string(txt)})
+	}
+
+	if c.WebRTC != "" {
+		entries = append(entries, entry{webRTC, c.WebRTC})
+	}
+	if c.ReportURI != "" {
+		entries = append(entries, entry{reportURI, c.ReportURI})
+	}
+	if c.ReportTo != "" {
+		entries = append(entries, entry{reportTo, c.ReportTo})
+	}
+
+	extra := make([]string, 0, len(c.Extra))
+	for k := range c.Extra {
+		extra = append(extra, k)
 	}
-	if len(c.MediaSrc) != 0 {
-		txt, _ := c.MediaSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", mediaSrc, txt))
+	sort.Strings(extra)
+	for _, k := range extra {
+		txt, _ := c.Extra[k].MarshalText()
+		entries = append(entries, entry{k, string(txt)})
 	}
-	if len(c.ObjectSrc) != 0 {
-		txt, _ := c.ObjectSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", objectSrc, txt))
+
+	return entries
+}
+
+// joinEntries joins marshaled directives into a policy
+func joinEntries(entries []entry) []byte {
+	policies := make([]string, len(entries))
+	for i, e := range entries {
+		policies[i] = e.String()
 	}
-	if len(c.ScriptSrc) != 0 {
-		txt, _ := c.ScriptSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", scriptSrc, txt))
+	return []byte(strings.TrimSpace(strings.Join(policies, "; ")))
+}
+
+// MarshalText marshals a CSP policy to text
+func (c *CSP) MarshalText() ([]byte, error) {
+	return joinEntries(c.entries()), nil
+}
+
+// MarshalTextTo marshals a CSP policy to text, appending to a buffer
+// This produces the same output as MarshalText without allocating intermediate strings, for use with pooled buffers.
+func (c *CSP) MarshalTextTo(buf *bytes.Buffer) {
+	start := buf.Len()
+
+	writeEntry := func(name string) {
+		if buf.Len() != start {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(name)
 	}
-	if len(c.StyleSrc) != 0 {
-		txt, _ := c.StyleSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", styleSrc, txt))
+	writeValue := func(value string) {
+		if value != "" {
+			buf.WriteByte(' ')
+			buf.WriteString(value)
+		}
 	}
-	if len(c.WorkerSrc) != 0 {
-		txt, _ := c.WorkerSrc.MarshalText()
-		policies = append(policies, fmt.Sprintf("%s %s", workerSrc, txt))
+
+	for _, d := range c.directives() {
+		if len(*d.sources) == 0 {
+			if *d.sources != nil && valueless[d.name] {
+				writeEntry(d.name)
+			}
+			continue
+		}
+		writeEntry(d.name)
+		d.sources.writeTo(buf)
 	}
 
+	if c.WebRTC != "" {
+		writeEntry(webRTC)
+		writeValue(c.WebRTC)
+	}
+	if c.ReportURI != "" {
+		writeEntry(reportURI)
+		writeValue(c.ReportURI)
+	}
 	if c.ReportTo != "" {
-		policies = append(policies, fmt.Sprintf("%s %s", reportTo, c.ReportTo))
+		writeEntry(reportTo)
+		writeValue(c.ReportTo)
+	}
+
+	if len(c.Extra) != 0 {
+		extra := make([]string, 0, len(c.Extra))
+		for k := range c.Extra {
+			extra = append(extra, k)
+		}
+		sort.Strings(extra)
+		for _, k := range extra {
+			writeEntry(k)
+			c.Extra[k].writeTo(buf)
+		}
 	}
 
-	return []byte(strings.TrimSpace(strings.Join(policies, "; "))), nil
+	// Match the surrounding whitespace trimming of MarshalText
+	b := buf.Bytes()[start:]
+	if t := bytes.TrimSpace(b); len(t) != len(b) {
+		buf.Truncate(start + copy(b, t))
+	}
 }
 
 // UnmarshalText un-marshals a CSP policy from text
+// Directive names are case insensitive and whitespace is normalised. Where a directive is repeated the first
+// occurrence is used and later occurrences ignored, matching browser behaviour.
 func (c *CSP) UnmarshalText(text []byte) error {
-	policies := strings.Split(string(text), ";")
+	for _, e := range splitDirectives(text) {
+		k, v := e.name, e.value
 
-	// Read polices into a map
-	for _, p := range policies {
-		l := strings.SplitN(strings.TrimSpace(p), " ", 2)
-		if p == "" || len(l) != 2 {
+		if s := c.sourceList(k); s != nil {
+			if v != "" {
+				s.UnmarshalText([]byte(v))
+			} else if valueless[k] {
+				*s = SourceList{}
+			} else {
+				*s = nil
+			}
 			continue
 		}
-		k, v := strings.TrimSpace(l[0]), strings.TrimSpace(l[1])
 
 		switch k {
-		case childSrc:
-			c.ChildSrc.UnmarshalText([]byte(v))
-		case connectSrc:
-			c.ConnectSrc.UnmarshalText([]byte(v))
-		case defaultSrc:
-			c.DefaultSrc.UnmarshalText([]byte(v))
-		case fontSrc:
-			c.FontSrc.UnmarshalText([]byte(v))
-		case frameSrc:
-			c.FrameSrc.UnmarshalText([]byte(v))
-		case imgSrc:
-			c.ImgSrc.UnmarshalText([]byte(v))
-		case manifestSrc:
-			c.ManifestSrc.UnmarshalText([]byte(v))
-		case mediaSrc:
-			c.MediaSrc.UnmarshalText([]byte(v))
-		case objectSrc:
-			c.ObjectSrc.UnmarshalText([]byte(v))
-		case scriptSrc:
-			c.ScriptSrc.UnmarshalText([]byte(v))
-		case styleSrc:
-			c.StyleSrc.UnmarshalText([]byte(v))
-		case workerSrc:
-			c.WorkerSrc.UnmarshalText([]byte(v))
+		case webRTC:
+			c.WebRTC = v
+		case reportURI:
+			c.ReportURI = v
 		case reportTo:
 			c.ReportTo = v
+		default:
+			// Preserve unknown directives
+			sources := SourceList{}
+			if v != "" {
+				sources.UnmarshalText([]byte(v))
+			}
+			if c.Extra == nil {
+				c.Extra = make(map[string]SourceList)
+			}
+			c.Extra[k] = sources
 		}
 	}
 
 	return nil
 }
 
+// Parse parses and validates a CSP policy from text
+func Parse(text string) (CSP, error) {
+	c := CSP{}
+	err := c.UnmarshalText([]byte(text))
+	if err != nil {
+		return CSP{}, err
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return CSP{}, err
+	}
+
+	return c, nil
+}
+
+// ParseWithRaw parses and validates a CSP policy from text, also returning a copy of the unmodified input
+// for audit logging where the re-marshaled policy differs from the original. The raw input is returned on error.
+func ParseWithRaw(text []byte) (CSP, []byte, error) {
+	raw := append([]byte{}, text...)
+	c, err := Parse(string(text))
+	return c, raw, err
+}
+
+// MustParse parses and validates a CSP policy from text, panicking on error
+func MustParse(text string) CSP {
+	c, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// splitDirectives splits policy text into directive names and values, in input order
+// Names are lower cased, whitespace is normalised and repeated directives after the first are dropped.
+func splitDirectives(text []byte) []entry {
+	entries := make([]entry, 0)
+	seen := make(map[string]bool)
+
+	for _, p := range strings.Split(string(text), ";") {
+		l := strings.Fields(p)
+		if len(l) == 0 {
+			continue
+		}
+		name := strings.ToLower(l[0])
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, entry{name, strings.Join(l[1:], " ")})
+	}
+
+	return entries
+}
+
+// ParseMap parses policy text into a map of directive names to sources, including unknown directives
+// Parsing follows UnmarshalText, though values are not interpreted (eg. webrtc values are returned as single sources).
+func ParseMap(text []byte) (map[string]SourceList, error) {
+	m := make(map[string]SourceList)
+	for _, e := range splitDirectives(text) {
+		sources := SourceList{}
+		if err := sources.UnmarshalText([]byte(e.value)); err != nil {
+			return nil, err
+		}
+		m[e.name] = sources
+	}
+	return m, nil
+}
+
+// UnmarshalTextStrict un-marshals a CSP policy from text, returning an error listing any directives
+// outside the allowed set rather than preserving them. The policy is not modified on error.
+func (c *CSP) UnmarshalTextStrict(text []byte, allowed []string) error {
+	permitted := make(map[string]bool, len(allowed))
+	for _, v := range allowed {
+		permitted[strings.ToLower(v)] = true
+	}
+
+	disallowed := make([]string, 0)
+	for _, d := range InputOrder(text) {
+		if !permitted[d] {
+			disallowed = append(disallowed, d)
+		}
+	}
+	if len(disallowed) != 0 {
+		return fmt.Errorf("Disallowed directives %s", strings.Join(disallowed, ", "))
+	}
+
+	return c.UnmarshalText(text)
+}
+
+// ErrNoPolicy is returned by FromHeader where no CSP header is present
+var ErrNoPolicy = errors.New("No CSP header present")
+
+// ErrMultiplePolicies is returned by FromHeader where more than one policy is present, see PoliciesFromHeader
+var ErrMultiplePolicies = errors.New("Multiple CSP policies present")
+
+// FromHeader parses a policy from an http.Header, reading the Content-Security-Policy header or,
+// where this is absent, the report only header (setting ReportOnly).
+// Browsers enforce every policy where multiple header values or comma separated policies are present,
+// which cannot be represented by a single CSP, so this returns ErrMultiplePolicies (use PoliciesFromHeader).
+func FromHeader(h http.Header) (CSP, error) {
+	policies, err := PoliciesFromHeader(h)
+	if err != nil {
+		return CSP{}, err
+	}
+
+	// Report only policies are only used where no policy is enforced
+	enforced := make(Policies, 0, len(policies))
+	for _, p := range policies {
+		if !p.ReportOnly {
+			enforced = append(enforced, p)
+		}
+	}
+	if len(enforced) != 0 {
+		policies = enforced
+	}
+
+	if len(policies) > 1 {
+		return CSP{}, ErrMultiplePolicies
+	}
+	return policies[0], nil
+}
+
+// PoliciesFromHeader parses each policy from the Content-Security-Policy and report only headers of an http.Header,
+// with ReportOnly set for report only policies. Each header value and comma separated policy is parsed separately,
+// browsers enforce all of these so the most restrictive policy applies.
+func PoliciesFromHeader(h http.Header) (Policies, error) {
+	policies := make(Policies, 0)
+
+	for _, key := range []string{HeaderPolicy, HeaderReportOnly} {
+		for _, v := range h.Values(key) {
+			p := Policies{}
+			err := p.UnmarshalText([]byte(v))
+			if err != nil {
+				return nil, err
+			}
+			for i := range p {
+				p[i].ReportOnly = key == HeaderReportOnly
+			}
+			policies = append(policies, p...)
+		}
+	}
+
+	if len(policies) == 0 {
+		return nil, ErrNoPolicy
+	}
+	return policies, nil
+}
+
+// Policies is a list of CSP policies served in a single header
+// Browsers enforce every policy in the list, so the most restrictive policy applies
+type Policies []CSP
+
+// MarshalText marshals a list of policies to comma separated text
+func (p Policies) MarshalText() ([]byte, error) {
+	policies := make([]string, 0, len(p))
+
+	for i := range p {
+		txt, err := p[i].MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, string(txt))
+	}
+
+	return []byte(strings.Join(policies, ", ")), nil
+}
+
+// UnmarshalText un-marshals a comma separated list of policies from text
+func (p *Policies) UnmarshalText(text []byte) error {
+	policies := make(Policies, 0)
+
+	for _, v := range strings.Split(string(text), ",") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+
+		c := CSP{}
+		err := c.UnmarshalText([]byte(v))
+		if err != nil {
+			return err
+		}
+		policies = append(policies, c)
+	}
+
+	*p = policies
+
+	return nil
+}
+
 // SourceList List of CSP sources
 type SourceList []string
 
@@ -214,14 +834,114 @@ func NewSourceList(sources ...string) SourceList {
 	return s
 }
 
+// Contains checks whether a source list contains the provided source (by exact comparison)
+func (s SourceList) Contains(source string) bool {
+	for _, v := range s {
+		if v == source {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove returns a copy of the source list with all occurrences of a source removed, preserving order
+// A nil list remains nil, so unset directives are not set by removing sources.
+func (s SourceList) Remove(source string) SourceList {
+	if s == nil {
+		return nil
+	}
+	out := make(SourceList, 0, len(s))
+	for _, v := range s {
+		if v != source {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Canonical returns a sorted copy of the source list, for deterministic output regardless of insertion order
+// Sources are ordered 'none', 'self', other keywords, schemes, hosts then nonces and hashes, alphabetically within each.
+func (s SourceList) Canonical() SourceList {
+	if s == nil {
+		return nil
+	}
+	out := append(SourceList{}, s...)
+	sort.SliceStable(out, func(i, j int) bool {
+		ri, rj := sourceRank(out[i]), sourceRank(out[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// sourceRank orders sources by kind for Canonical
+func sourceRank(source string) int {
+	switch {
+	case source == SourceNone:
+		return 0
+	case source == SourceSelf:
+		return 1
+	case strings.HasPrefix(source, "'"):
+		for _, p := range quotedPrefixes {
+			if strings.HasPrefix(source, p) {
+				return 5
+			}
+		}
+		return 2
+	case strings.HasSuffix(source, ":") && schemePattern.MatchString(strings.TrimSuffix(source, ":")):
+		return 3
+	default:
+		return 4
+	}
+}
+
 // MarshalText marshals a source list to text
+// Sources are single space separated, with empty sources and surrounding whitespace dropped.
 func (s SourceList) MarshalText() ([]byte, error) {
-	str := strings.Join(s, " ")
-	return []byte(str), nil
+	b := make([]byte, 0, 64)
+	for _, v := range s {
+		for _, f := range strings.Fields(v) {
+			if len(b) != 0 {
+				b = append(b, ' ')
+			}
+			b = append(b, f...)
+		}
+	}
+	return b, nil
+}
+
+// writeTo writes the marshaled sources to a buffer, each source preceded by a space
+// Sources are split on whitespace as by MarshalText, without allocating.
+func (s SourceList) writeTo(buf *bytes.Buffer) {
+	for _, v := range s {
+		start := -1
+		for i, r := range v {
+			if unicode.IsSpace(r) {
+				if start >= 0 {
+					buf.WriteByte(' ')
+					buf.WriteString(v[start:i])
+					start = -1
+				}
+			} else if start < 0 {
+				start = i
+			}
+		}
+		if start >= 0 {
+			buf.WriteByte(' ')
+			buf.WriteString(v[start:])
+		}
+	}
 }
 
 // UnmarshalText unmarshals a source list from text
+// Common keyword quoting mistakes (eg. self or "self") are corrected to the single quoted form,
+// and empty input results in an empty source list.
 func (s *SourceList) UnmarshalText(text []byte) error {
-	*s = strings.Split(string(text), " ")
+	*s = strings.Fields(string(text))
+	for i, v := range *s {
+		(*s)[i] = normalizeKeyword(v)
+	}
 	return nil
 }
@@ -25,10 +25,12 @@ const reportString = ` {
 
 type MockReporter struct {
 	r Report
+	n int
 }
 
 func (mr *MockReporter) Report(r Report) error {
 	mr.r = r
+	mr.n++
 	return nil
 }
 func TestCSP(t *testing.T) {
@@ -40,6 +42,17 @@ func TestCSP(t *testing.T) {
 		assert.EqualValues(t, cspString, string(v))
 	})
 
+	t.Run("Default policy constant", func(t *testing.T) {
+		csp := Default()
+		v, err := csp.MarshalText()
+		require.Nil(t, err)
+		assert.EqualValues(t, DefaultPolicy, string(v))
+
+		rw := httptest.NewRecorder()
+		DefaultHandler(http.NotFoundHandler()).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy))
+	})
+
 	t.Run("Unmarshal CSP", func(t *testing.T) {
 		csp := CSP{}
 		err := csp.UnmarshalText([]byte(cspString))
@@ -83,6 +96,70 @@ func TestCSP(t *testing.T) {
 				ImgSrc:     NewSourceList(SourceAny),
 			},
 			"default-src 'self' *.mailsite.com; img-src *",
+		}, {"Trusted types",
+			CSP{
+				RequireTrustedTypesFor: []string{"'script'"},
+				TrustedTypes:           []string{"policy1", "policy2", "'allow-duplicates'"},
+			},
+			"require-trusted-types-for 'script'; trusted-types policy1 policy2 'allow-duplicates'",
+		}, {"Trusted types without policies",
+			CSP{
+				DefaultSrc:   NewSourceList(SourceSelf),
+				TrustedTypes: []string{},
+			},
+			"default-src 'self'; trusted-types",
+		}, {"Prefetch",
+			CSP{
+				DefaultSrc:  NewSourceList(SourceSelf),
+				PrefetchSrc: NewSourceList(SourceSelf, "cdn.example.com"),
+			},
+			"default-src 'self'; prefetch-src 'self' cdn.example.com",
+		}, {"Scheme sources",
+			CSP{
+				ImgSrc:     NewSourceList(SchemeData, SchemeHTTPS),
+				ConnectSrc: NewSourceList(SchemeWSS, SchemeBlob),
+			},
+			"connect-src wss: blob:; img-src data: https:",
+		}, {"Plugin types",
+			CSP{
+				ObjectSrc:   NewSourceList(SourceSelf),
+				PluginTypes: []string{"application/pdf", "application/x-shockwave-flash"},
+			},
+			"object-src 'self'; plugin-types application/pdf application/x-shockwave-flash",
+		}, {"Require SRI",
+			CSP{
+				ScriptSrc:     NewSourceList(SourceSelf),
+				RequireSRIFor: []string{"script", "style"},
+			},
+			"script-src 'self'; require-sri-for script style",
+		}, {"Navigate to",
+			CSP{
+				DefaultSrc: NewSourceList(SourceSelf),
+				NavigateTo: NewSourceList(SourceSelf, "https://example.com"),
+			},
+			"default-src 'self'; navigate-to 'self' https://example.com",
+		}, {"WebRTC",
+			CSP{
+				DefaultSrc: NewSourceList(SourceSelf),
+				WebRTC:     WebRTCBlock,
+			},
+			"default-src 'self'; webrtc 'block'",
+		}, {"Reporting",
+			CSP{
+				DefaultSrc: NewSourceList(SourceSelf),
+				ReportURI:  "/_/csp-reports",
+				ReportTo:   "csp-endpoint",
+			},
+			"default-src 'self'; report-uri /_/csp-reports; report-to csp-endpoint",
+		}, {"Unknown directives",
+			CSP{
+				DefaultSrc: NewSourceList(SourceSelf),
+				Extra: map[string]SourceList{
+					"sandbox":                   NewSourceList("allow-scripts"),
+					"upgrade-insecure-requests": NewSourceList(),
+				},
+			},
+			"default-src 'self'; sandbox allow-scripts; upgrade-insecure-requests",
 		},
 	}
 
@@ -92,6 +169,10 @@ func TestCSP(t *testing.T) {
 			require.Nil(t, err)
 			assert.EqualValues(t, v.txt, string(txt))
 
+			buf := bytes.NewBufferString("prefix ")
+			v.csp.MarshalTextTo(buf)
+			assert.EqualValues(t, "prefix "+v.txt, buf.String())
+
 			csp2 := CSP{}
 			err = csp2.UnmarshalText(txt)
 			require.Nil(t, err)
@@ -99,6 +180,482 @@ func TestCSP(t *testing.T) {
 		})
 	}
 
+	t.Run("Config round trip", func(t *testing.T) {
+		csp := Default()
+		csp.ReportOnly = true
+
+		cfg, err := csp.MarshalConfig()
+		require.Nil(t, err)
+
+		csp2 := CSP{}
+		err = csp2.UnmarshalConfig(cfg)
+		require.Nil(t, err)
+		assert.EqualValues(t, csp, csp2)
+		assert.True(t, csp2.ReportOnly)
+	})
+
+	t.Run("Config round trip with handler settings", func(t *testing.T) {
+		csp := Strict()
+		csp.NonceDirectives = []string{scriptSrc, styleSrc}
+		csp.HTMLOnly = true
+		csp.SkipStatus = []int{http.StatusNotModified}
+		csp.ReportTo = "csp"
+		csp.ReportingGroups = []ReportingGroup{{Name: "csp", Endpoint: "https://example.com/csp", MaxAge: 60}}
+
+		cfg, err := csp.MarshalConfig()
+		require.Nil(t, err)
+
+		csp2 := CSP{}
+		err = csp2.UnmarshalConfig(cfg)
+		require.Nil(t, err)
+		assert.EqualValues(t, csp, csp2)
+	})
+
+	t.Run("Marshal Unmarshal multiple policies", func(t *testing.T) {
+		policies := Policies{
+			Default(),
+			CSP{
+				DefaultSrc: NewSourceList(SourceSelf, "*.trusted.com"),
+				ImgSrc:     NewSourceList(SourceAny),
+			},
+		}
+
+		txt, err := policies.MarshalText()
+		require.Nil(t, err)
+		assert.EqualValues(t, cspString+", default-src 'self' *.trusted.com; img-src *", string(txt))
+
+		policies2 := Policies{}
+		err = policies2.UnmarshalText(txt)
+		require.Nil(t, err)
+		assert.EqualValues(t, policies, policies2)
+	})
+
+	t.Run("Unmarshal normalises whitespace and case", func(t *testing.T) {
+		csp := CSP{}
+		err := csp.UnmarshalText([]byte(";; Default-Src\t'none' ;  connect-src   'self';img-src 'self'; script-src 'self' ; style-src 'self';;"))
+		require.Nil(t, err)
+		assert.EqualValues(t, Default(), csp)
+	})
+
+	t.Run("Unmarshal mixed case directive names", func(t *testing.T) {
+		csp := CSP{}
+		err := csp.UnmarshalText([]byte("Default-Src 'self'; SCRIPT-SRC 'self'"))
+		require.Nil(t, err)
+		assert.EqualValues(t, CSP{DefaultSrc: NewSourceList(SourceSelf), ScriptSrc: NewSourceList(SourceSelf)}, csp)
+	})
+
+	t.Run("Unmarshal multi-line policy", func(t *testing.T) {
+		csp := CSP{}
+		err := csp.UnmarshalText([]byte("default-src 'none';\n\tconnect-src\t'self';\r\n\timg-src 'self'\n\t\t'unsafe-inline';\n\tscript-src 'self';\n\tstyle-src 'self'\n"))
+		require.Nil(t, err)
+
+		expected := Default()
+		expected.ImgSrc = NewSourceList(SourceSelf, SourceUnsafeInline)
+		assert.EqualValues(t, expected, csp)
+	})
+
+	t.Run("Unmarshal repeated directives uses first occurrence", func(t *testing.T) {
+		csp := CSP{}
+		err := csp.UnmarshalText([]byte("script-src a.example.com; report-to a; sandbox; script-src b.example.com; report-to b; sandbox allow-scripts; Script-Src; "))
+		require.Nil(t, err)
+		assert.EqualValues(t, CSP{
+			ScriptSrc: NewSourceList("a.example.com"),
+			ReportTo:  "a",
+			Extra:     map[string]SourceList{"sandbox": {}},
+		}, csp)
+	})
+
+	t.Run("Parse policy", func(t *testing.T) {
+		c, err := Parse(cspString)
+		require.Nil(t, err)
+		assert.EqualValues(t, Default(), c)
+
+		_, err = Parse("default-src 'self; img-src *example.com")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Parse policy with raw input", func(t *testing.T) {
+		text := []byte("Default-Src 'none';\tconnect-src 'self' ; img-src 'self'; script-src 'self'; style-src 'self';")
+		c, raw, err := ParseWithRaw(text)
+		require.Nil(t, err)
+		assert.EqualValues(t, Default(), c)
+		assert.Equal(t, text, raw)
+
+		text[0] = 'd'
+		assert.Equal(t, byte('D'), raw[0])
+
+		_, raw, err = ParseWithRaw([]byte("script-src 'bogus'"))
+		assert.NotNil(t, err)
+		assert.Equal(t, []byte("script-src 'bogus'"), raw)
+	})
+
+	t.Run("MustParse policy", func(t *testing.T) {
+		assert.EqualValues(t, Default(), MustParse(cspString))
+		assert.Panics(t, func() { MustParse("script-src 'bogus'") })
+	})
+
+	t.Run("Parse policy map", func(t *testing.T) {
+		m, err := ParseMap([]byte("default-src self; script-src 'self' cdn.example.com; webrtc 'block'; upgrade-insecure-requests; Sandbox allow-scripts; script-src b.example.com"))
+		require.Nil(t, err)
+		assert.EqualValues(t, map[string]SourceList{
+			defaultSrc:                  {SourceSelf},
+			scriptSrc:                   {SourceSelf, "cdn.example.com"},
+			webRTC:                      {WebRTCBlock},
+			"upgrade-insecure-requests": {},
+			"sandbox":                   {"allow-scripts"},
+		}, m)
+	})
+
+	t.Run("Unmarshal CSP strict", func(t *testing.T) {
+		allowed := []string{defaultSrc, connectSrc, imgSrc, scriptSrc, styleSrc}
+
+		csp := CSP{}
+		err := csp.UnmarshalTextStrict([]byte(cspString), allowed)
+		require.Nil(t, err)
+		assert.EqualValues(t, Default(), csp)
+
+		csp = CSP{}
+		err = csp.UnmarshalTextStrict([]byte(cspString+"; report-uri /csp; frame-src *"), allowed)
+		assert.EqualError(t, err, "Disallowed directives report-uri, frame-src")
+		assert.EqualValues(t, CSP{}, csp)
+	})
+
+	t.Run("Parse policy from header", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(HeaderPolicy, cspString)
+
+		csp, err := FromHeader(h)
+		require.Nil(t, err)
+		assert.EqualValues(t, Default(), csp)
+	})
+
+	t.Run("Parse report only policy from header", func(t *testing.T) {
+		h := http.Header{}
+		h.Add(HeaderReportOnly, "default-src 'none'; img-src 'self'")
+
+		csp, err := FromHeader(h)
+		require.Nil(t, err)
+		assert.EqualValues(t, CSP{
+			ReportOnly: true,
+			DefaultSrc: NewSourceList(SourceNone),
+			ImgSrc:     NewSourceList(SourceSelf),
+		}, csp)
+	})
+
+	t.Run("Parse multiple policies from header", func(t *testing.T) {
+		h := http.Header{}
+		h.Add(HeaderPolicy, "script-src 'self'")
+		h.Add(HeaderPolicy, "script-src *, img-src 'self'")
+		h.Add(HeaderReportOnly, "default-src 'none'")
+
+		policies, err := PoliciesFromHeader(h)
+		require.Nil(t, err)
+		assert.EqualValues(t, Policies{
+			{ScriptSrc: NewSourceList(SourceSelf)},
+			{ScriptSrc: NewSourceList(SourceAny)},
+			{ImgSrc: NewSourceList(SourceSelf)},
+			{ReportOnly: true, DefaultSrc: NewSourceList(SourceNone)},
+		}, policies)
+
+		_, err = FromHeader(h)
+		assert.ErrorIs(t, err, ErrMultiplePolicies)
+
+		h.Del(HeaderPolicy)
+		csp, err := FromHeader(h)
+		require.Nil(t, err)
+		assert.EqualValues(t, CSP{ReportOnly: true, DefaultSrc: NewSourceList(SourceNone)}, csp)
+	})
+
+	t.Run("Parse missing policy from header", func(t *testing.T) {
+		csp, err := FromHeader(http.Header{})
+		assert.ErrorIs(t, err, ErrNoPolicy)
+		assert.EqualValues(t, CSP{}, csp)
+	})
+
+	t.Run("Dual handler sets both headers", func(t *testing.T) {
+		enforced := Default()
+		reportOnly := CSP{DefaultSrc: NewSourceList(SourceNone)}
+
+		h := DualHandler(enforced, reportOnly, http.NotFoundHandler())
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, cspString, rw.Header().Get(HeaderPolicy))
+		assert.Equal(t, "default-src 'none'", rw.Header().Get(HeaderReportOnly))
+	})
+
+	directiveNames := []string{
+		"default-src", "child-src", "connect-src", "font-src", "frame-src", "img-src", "manifest-src", "media-src",
+		"object-src", "prefetch-src", "script-src", "style-src", "worker-src", "base-uri", "plugin-types", "require-sri-for", "navigate-to", "require-trusted-types-for", "trusted-types",
+	}
+	for _, name := range directiveNames {
+		t.Run(fmt.Sprintf("Add source to %s", name), func(t *testing.T) {
+			csp := CSP{}
+			err := csp.AddSource(name, SourceSelf, "example.com")
+			require.Nil(t, err)
+
+			txt, _ := csp.MarshalText()
+			assert.EqualValues(t, name+" 'self' example.com", string(txt))
+		})
+	}
+
+	t.Run("Add source to unknown directive", func(t *testing.T) {
+		csp := CSP{}
+		assert.NotNil(t, csp.AddSource("script-source", SourceSelf))
+		assert.NotNil(t, csp.AddSource(reportTo, "group"))
+	})
+
+	t.Run("With reporting sets report-uri and report-to", func(t *testing.T) {
+		csp := Default()
+		csp.WithReporting("/_/csp-reports", "csp-endpoint")
+
+		txt, err := csp.MarshalText()
+		require.Nil(t, err)
+		assert.Contains(t, string(txt), "; report-uri /_/csp-reports; report-to csp-endpoint")
+	})
+
+	t.Run("Strip reporting", func(t *testing.T) {
+		csp := Default()
+		csp.WithReporting("/_/csp-reports", "csp-endpoint")
+		csp.AddReportingGroup(ReportingGroup{Name: "csp-endpoint", Endpoint: "https://example.com/_/csp-reports", MaxAge: 3600})
+		csp.Extra = map[string]SourceList{reportURI: {"/internal"}, "sandbox": {}}
+
+		csp.StripReporting()
+		assert.Empty(t, csp.ReportingGroups)
+
+		txt, err := csp.MarshalText()
+		require.Nil(t, err)
+		assert.Equal(t, cspString+"; sandbox", string(txt))
+	})
+
+	t.Run("Unmarshal empty source list", func(t *testing.T) {
+		s := SourceList{}
+		err := s.UnmarshalText([]byte(""))
+		require.Nil(t, err)
+		assert.Len(t, s, 0)
+
+		err = s.UnmarshalText([]byte(" 'self'  example.com "))
+		require.Nil(t, err)
+		assert.EqualValues(t, NewSourceList(SourceSelf, "example.com"), s)
+
+		txt, _ := s.MarshalText()
+		assert.EqualValues(t, "'self' example.com", string(txt))
+	})
+
+	t.Run("Enable report sample", func(t *testing.T) {
+		csp := Default()
+		err := csp.EnableReportSample(scriptSrc, styleSrc, scriptSrc)
+		require.Nil(t, err)
+		assert.EqualValues(t, NewSourceList(SourceSelf, SourceReportSample), csp.ScriptSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf, SourceReportSample), csp.StyleSrc)
+
+		assert.NotNil(t, csp.EnableReportSample("script-source"))
+	})
+
+	t.Run("Add nonce to directives", func(t *testing.T) {
+		shared := Default()
+		c := shared
+
+		err := c.AddNonce("YWJjMTIz", scriptSrc, styleSrc)
+		require.Nil(t, err)
+		assert.EqualValues(t, NewSourceList(SourceSelf, "'nonce-YWJjMTIz'"), c.ScriptSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf, "'nonce-YWJjMTIz'"), c.StyleSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf), shared.ScriptSrc)
+
+		assert.NotNil(t, c.AddNonce("", scriptSrc))
+		assert.NotNil(t, c.AddNonce("not base64!", scriptSrc))
+		assert.NotNil(t, c.AddNonce("YWJjMTIz", "script-source"))
+	})
+
+	t.Run("Add nonce to unset directives keeps fallback sources", func(t *testing.T) {
+		c := CSP{DefaultSrc: NewSourceList(SourceSelf)}
+		require.Nil(t, c.AddNonce("YWJjMTIz", styleSrc))
+		assert.EqualValues(t, NewSourceList(SourceSelf, "'nonce-YWJjMTIz'"), c.StyleSrc)
+		assert.Nil(t, c.ScriptSrc)
+	})
+
+	t.Run("Add nonce validates nonce and directives", func(t *testing.T) {
+		c := Default()
+		require.Nil(t, c.AddNonce("a-b_c", "script-src-elem"))
+		require.Nil(t, c.AddNonce("YWJjMTI+/w==", defaultSrc))
+		assert.EqualValues(t, map[string]SourceList{"script-src-elem": {SourceSelf, "'nonce-a-b_c'"}}, c.Extra)
+		assert.EqualValues(t, NewSourceList(SourceNone, "'nonce-YWJjMTI+/w=='"), c.DefaultSrc)
+
+		assert.NotNil(t, c.AddNonce("YWJj===", scriptSrc))
+		assert.NotNil(t, c.AddNonce("YWJjMTIz", scriptSrc, trustedTypes))
+		assert.NotNil(t, c.AddNonce("YWJjMTIz", requireTrustedTypesFor))
+		assert.EqualValues(t, NewSourceList(SourceSelf), c.ScriptSrc)
+		assert.Nil(t, c.TrustedTypes)
+
+		c.NonceDirectives = []string{scriptSrc, baseURI}
+		assert.NotNil(t, c.Validate())
+	})
+
+	t.Run("Toggle report only", func(t *testing.T) {
+		c := Default()
+
+		r := c.AsReportOnly()
+		assert.True(t, r.ReportOnly)
+		assert.False(t, c.ReportOnly)
+
+		r.ScriptSrc[0] = "cdn.example.com"
+		assert.EqualValues(t, Default(), c)
+
+		e := r.AsEnforced()
+		assert.False(t, e.ReportOnly)
+		assert.True(t, r.ReportOnly)
+	})
+
+	t.Run("Source list whitespace round trip", func(t *testing.T) {
+		s := SourceList{}
+		err := s.UnmarshalText([]byte("\t'self'   https://cdn.example.com \n 'nonce-abc123'  "))
+		require.Nil(t, err)
+
+		txt, _ := s.MarshalText()
+		assert.EqualValues(t, "'self' https://cdn.example.com 'nonce-abc123'", string(txt))
+
+		txt, _ = SourceList{" 'self'", "", "https://cdn.example.com "}.MarshalText()
+		assert.EqualValues(t, "'self' https://cdn.example.com", string(txt))
+	})
+
+	t.Run("Map sources", func(t *testing.T) {
+		c := Default()
+		c.ScriptSrc = NewSourceList(SourceSelf, "example.com", "old.example.com")
+		c.ImgSrc = NewSourceList("example.com")
+		c.Extra = map[string]SourceList{"script-src-elem": {"example.com"}}
+
+		m := c.MapSources(func(directive, source string) string {
+			switch source {
+			case "example.com":
+				return "cdn.example.com"
+			case "old.example.com":
+				return ""
+			}
+			return source
+		})
+
+		assert.EqualValues(t, NewSourceList(SourceSelf, "cdn.example.com"), m.ScriptSrc)
+		assert.EqualValues(t, NewSourceList("cdn.example.com"), m.ImgSrc)
+		assert.EqualValues(t, NewSourceList("cdn.example.com"), m.Extra["script-src-elem"])
+		assert.EqualValues(t, NewSourceList(SourceNone), m.DefaultSrc)
+		assert.Nil(t, m.FontSrc)
+
+		// The original policy is unchanged
+		assert.EqualValues(t, NewSourceList(SourceSelf, "example.com", "old.example.com"), c.ScriptSrc)
+		assert.EqualValues(t, NewSourceList("example.com"), c.Extra["script-src-elem"])
+	})
+
+	t.Run("Map sources dropping every source", func(t *testing.T) {
+		c := CSP{
+			DefaultSrc:    NewSourceList(SourceAny),
+			ScriptSrc:     NewSourceList("old.example.com"),
+			RequireSRIFor: []string{"script"},
+			TrustedTypes:  []string{"old"},
+			Extra:         map[string]SourceList{"frame-ancestors": {"old.example.com"}},
+		}
+
+		m := c.MapSources(func(directive, source string) string {
+			if source == SourceAny {
+				return source
+			}
+			return ""
+		})
+
+		txt, err := m.MarshalText()
+		require.Nil(t, err)
+		assert.Equal(t, "default-src *; script-src 'none'; trusted-types; frame-ancestors 'none'", string(txt))
+	})
+
+	t.Run("Policy hosts", func(t *testing.T) {
+		c := Strict()
+		c.ScriptSrc = append(c.ScriptSrc, "https://cdn.example.com", "'nonce-abc123'", "'sha256-abc123='", NoncePlaceholder)
+		c.ImgSrc = NewSourceList(SourceSelf, SchemeData, "*.images.example.com", "https://cdn.example.com")
+		c.ConnectSrc = NewSourceList(SourceAny, SchemeWSS, "api.example.com:443")
+		c.TrustedTypes = []string{"default"}
+
+		assert.EqualValues(t, []string{"*.images.example.com", "api.example.com:443", "https://cdn.example.com"}, c.Hosts())
+		assert.Empty(t, Default().Hosts())
+	})
+
+	t.Run("Source list contains source", func(t *testing.T) {
+		s := NewSourceList(SourceSelf, "cdn.example.com")
+		assert.True(t, s.Contains(SourceSelf))
+		assert.True(t, s.Contains("cdn.example.com"))
+		assert.False(t, s.Contains("self"))
+		assert.False(t, s.Contains("example.com"))
+	})
+
+	t.Run("Canonical source order", func(t *testing.T) {
+		s := NewSourceList("'sha256-abc='", "cdn.example.com", SchemeHTTPS, SourceUnsafeInline, "'nonce-xyz'", SourceSelf, "*.example.com", SchemeData, SourceStrictDynamic, SourceNone)
+		assert.EqualValues(t, NewSourceList(SourceNone, SourceSelf, SourceStrictDynamic, SourceUnsafeInline, SchemeData, SchemeHTTPS, "*.example.com", "cdn.example.com", "'nonce-xyz'", "'sha256-abc='"), s.Canonical())
+		assert.Equal(t, "'sha256-abc='", s[0])
+	})
+
+	t.Run("Directive names are case insensitive", func(t *testing.T) {
+		c := Default()
+		assert.True(t, c.Has("Script-Src"))
+		assert.True(t, c.Allows("Script-Src", SourceSelf))
+
+		require.Nil(t, c.AddSource("IMG-SRC", "cdn.example.com"))
+		require.Nil(t, c.RemoveSource("Img-Src", SourceSelf))
+		require.Nil(t, c.EnableReportSample("Script-Src"))
+		assert.EqualValues(t, NewSourceList("cdn.example.com"), c.ImgSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf, SourceReportSample), c.ScriptSrc)
+
+		b, err := NewBuilder().Add("Script-Src", SourceSelf).Build()
+		require.Nil(t, err)
+		assert.EqualValues(t, NewSourceList(SourceSelf), b.ScriptSrc)
+
+		assert.Nil(t, c.UnmarshalTextStrict([]byte("script-src 'self'"), []string{"Script-Src"}))
+	})
+
+	t.Run("Policy has directive", func(t *testing.T) {
+		c := Default()
+		c.ReportTo = "csp-endpoint"
+		c.Extra = map[string]SourceList{"upgrade-insecure-requests": {}}
+
+		assert.True(t, c.Has(scriptSrc))
+		assert.True(t, c.Has("Script-Src"))
+		assert.True(t, c.Has(reportTo))
+		assert.True(t, c.Has("upgrade-insecure-requests"))
+
+		assert.False(t, c.Has(frameSrc))
+		assert.False(t, c.Has(reportURI))
+		assert.False(t, c.Has("block-all-mixed-content"))
+
+		assert.False(t, c.Has(trustedTypes))
+		c.TrustedTypes = []string{}
+		assert.True(t, c.Has(trustedTypes))
+	})
+
+	t.Run("Policy allows source", func(t *testing.T) {
+		csp := Default()
+		assert.True(t, csp.Allows(scriptSrc, SourceSelf))
+		assert.False(t, csp.Allows(scriptSrc, SourceUnsafeInline))
+		assert.False(t, csp.Allows("script-source", SourceSelf))
+	})
+
+	t.Run("Remove keyword source", func(t *testing.T) {
+		s := NewSourceList(SourceSelf, "cdn.example.com", SourceUnsafeInline)
+		assert.EqualValues(t, SourceList{SourceSelf, "cdn.example.com"}, s.Remove(SourceUnsafeInline))
+		assert.EqualValues(t, SourceList{SourceSelf, "cdn.example.com", SourceUnsafeInline}, s)
+	})
+
+	t.Run("Remove repeated host source", func(t *testing.T) {
+		csp := CSP{ScriptSrc: SourceList{"cdn.example.com", SourceSelf, "cdn.example.com", "static.example.com"}}
+		err := csp.RemoveSource(scriptSrc, "cdn.example.com")
+		require.Nil(t, err)
+		assert.EqualValues(t, SourceList{SourceSelf, "static.example.com"}, csp.ScriptSrc)
+
+		assert.NotNil(t, csp.RemoveSource("script-source", SourceSelf))
+
+		c := Default()
+		require.Nil(t, c.RemoveSource(trustedTypes, "default"))
+		assert.Nil(t, c.TrustedTypes)
+		txt, _ := c.MarshalText()
+		assert.Equal(t, DefaultPolicy, string(txt))
+	})
+
 	t.Run("Unmarshal reports", func(t *testing.T) {
 		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
 		req.Header.Set("Content-Type", ReportContentType)
@@ -125,11 +682,39 @@ func TestCSP(t *testing.T) {
 func BenchmarkCSP(b *testing.B) {
 	b.Run("Marshal CSP", func(b *testing.B) {
 		csp := Default()
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			csp.MarshalText()
 		}
 	})
 
+	b.Run("Marshal CSP to buffer", func(b *testing.B) {
+		csp := Default()
+		buf := bytes.Buffer{}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			csp.MarshalTextTo(&buf)
+		}
+	})
+
+	b.Run("Serve Default", func(b *testing.B) {
+		csp := Default()
+		h := csp.Handler(http.NotFoundHandler())
+		req := httptest.NewRequest("GET", "/", nil)
+		for i := 0; i < b.N; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+
+	b.Run("Serve DefaultHandler", func(b *testing.B) {
+		h := DefaultHandler(http.NotFoundHandler())
+		req := httptest.NewRequest("GET", "/", nil)
+		for i := 0; i < b.N; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+
 	b.Run("Unmarshal CSP", func(b *testing.B) {
 		csp := CSP{}
 		for i := 0; i < b.N; i++ {
@@ -137,3 +722,35 @@ func BenchmarkCSP(b *testing.B) {
 		}
 	})
 }
+
+func FuzzUnmarshalText(f *testing.F) {
+	for _, s := range []string{
+		cspString,
+		"",
+		";;;",
+		"script-src 'self'; script-src a.example.com",
+		"trusted-types; upgrade-insecure-requests; report-to  group",
+		"Default-Src\tself ;\n img-src \"none\" data:",
+		"webrtc 'block'; report-uri /a /b",
+	} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		c := CSP{}
+		require.Nil(t, c.UnmarshalText([]byte(text)))
+		txt, err := c.MarshalText()
+		require.Nil(t, err)
+
+		c2 := CSP{}
+		require.Nil(t, c2.UnmarshalText(txt))
+		txt2, err := c2.MarshalText()
+		require.Nil(t, err)
+
+		assert.Equal(t, string(txt), string(txt2))
+
+		buf := bytes.Buffer{}
+		c.MarshalTextTo(&buf)
+		assert.Equal(t, string(txt), buf.String())
+	})
+}
@@ -0,0 +1,21 @@
+// Package cspchi provides helpers for using CSP policies and report handlers with go-chi routers
+package cspchi
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+// Mount registers the policy middleware on a router, along with a POST route at reportPath handling reports with the provided reporter
+// As chi requires middleware to be registered before routes, this must be called prior to defining other routes on the router.
+// A nil reporter uses the default logging reporter.
+func Mount(r chi.Router, reportPath string, c *csp.CSP, reporter csp.ReportHandler) {
+	r.Use(c.Handler)
+
+	if reporter == nil {
+		r.Post(reportPath, csp.RouteHandler())
+		return
+	}
+	r.Post(reportPath, csp.RouteHandler(reporter))
+}
@@ -0,0 +1,50 @@
+package cspchi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+type mockReporter struct {
+	reports []csp.Report
+}
+
+func (m *mockReporter) Report(r csp.Report) error {
+	m.reports = append(m.reports, r)
+	return nil
+}
+
+func TestMount(t *testing.T) {
+	policy := csp.Default()
+	reporter := mockReporter{}
+
+	r := chi.NewRouter()
+	Mount(r, "/_/csp-reports", &policy, &reporter)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Sets policy header", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, csp.DefaultPolicy, rw.Header().Get(csp.HeaderPolicy))
+	})
+
+	t.Run("Handles reports", func(t *testing.T) {
+		body := `{"csp-report": {"document-uri": "https://example.com/", "blocked-uri": "inline", "violated-directive": "script-src"}}`
+		req := httptest.NewRequest("POST", "/_/csp-reports", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", csp.ReportContentType)
+		rw := httptest.NewRecorder()
+
+		r.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Len(t, reporter.reports, 1)
+		assert.Equal(t, "inline", reporter.reports[0].BlockedURI)
+	})
+}
@@ -0,0 +1,20 @@
+// Package cspnegroni provides CSP middleware for negroni
+package cspnegroni
+
+import (
+	"net/http"
+
+	"github.com/urfave/negroni"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+// Handler creates negroni middleware attaching the policy headers before calling the next handler
+// This behaves as c.Handler, including per-request nonces and policies selected with csp.WithPolicy,
+// and likewise holds a copy of the policy so later changes to c do not affect the middleware.
+func Handler(c *csp.CSP) negroni.HandlerFunc {
+	serve := c.ServeNext()
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		serve(rw, r, next)
+	}
+}
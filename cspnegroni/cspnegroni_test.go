@@ -0,0 +1,50 @@
+package cspnegroni
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/negroni"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+func TestHandler(t *testing.T) {
+
+	t.Run("Sets policy header", func(t *testing.T) {
+		policy := csp.Default()
+		n := negroni.New(Handler(&policy))
+		n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		rw := httptest.NewRecorder()
+		n.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, csp.DefaultPolicy, rw.Header().Get(csp.HeaderPolicy))
+	})
+
+	t.Run("Holds a copy of the policy", func(t *testing.T) {
+		policy := csp.Default()
+		n := negroni.New(Handler(&policy))
+		n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		policy.ScriptSrc[0] = "cdn.example.com"
+
+		rw := httptest.NewRecorder()
+		n.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, csp.DefaultPolicy, rw.Header().Get(csp.HeaderPolicy))
+	})
+
+	t.Run("Passes nonce to next handler", func(t *testing.T) {
+		policy := csp.Strict()
+		n := negroni.New(Handler(&policy))
+		n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(csp.NonceFromContext(r.Context())))
+		}))
+
+		rw := httptest.NewRecorder()
+		n.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Len(t, rw.Body.String(), 24)
+		assert.Contains(t, rw.Header().Get(csp.HeaderPolicy), fmt.Sprintf("'nonce-%s'", rw.Body.String()))
+	})
+}
@@ -0,0 +1,95 @@
+// Package cspprometheus provides a CSP ReportHandler exporting violation counts as Prometheus metrics
+package cspprometheus
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+// Reporter is a csp.ReportHandler that counts CSP violations by directive and blocked host
+type Reporter struct {
+	violations *prometheus.CounterVec
+}
+
+var _ csp.ReportHandler = &Reporter{}
+
+// NewPrometheusReporter creates a Reporter, registering a csp_violations_total counter with the provided registerer
+// A nil registerer uses prometheus.DefaultRegisterer.
+func NewPrometheusReporter(registerer prometheus.Registerer) (*Reporter, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	violations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "csp_violations_total",
+		Help: "Count of CSP violation reports by violated directive and blocked host",
+	}, []string{"violated_directive", "blocked_host"})
+
+	err := registerer.Register(violations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reporter{violations}, nil
+}
+
+// Report increments the violation counter for a report
+func (p *Reporter) Report(r csp.Report) error {
+	p.violations.WithLabelValues(directive(r), blockedHost(r.BlockedURI)).Inc()
+	return nil
+}
+
+// directive fetches the name of the violated directive, omitting the directive sources
+func directive(r csp.Report) string {
+	if r.EffectiveDirective != "" {
+		return r.EffectiveDirective
+	}
+	if f := strings.Fields(r.ViolatedDirective); len(f) != 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// blockedValues are the non-URL blocked-uri values and schemes reported by browsers
+var blockedValues = map[string]bool{
+	"inline":               true,
+	"eval":                 true,
+	"wasm-eval":            true,
+	"self":                 true,
+	"trusted-types-policy": true,
+	"trusted-types-sink":   true,
+	"data":                 true,
+	"blob":                 true,
+	"filesystem":           true,
+	"about":                true,
+	"javascript":           true,
+}
+
+// blockedHost reduces a blocked-uri to its host to bound label cardinality
+// Non-URL values and schemes such as inline or data are kept where known, with any other value reported as other
+// so clients cannot create arbitrary series.
+func blockedHost(uri string) string {
+	if uri == "" {
+		return ""
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "other"
+	}
+	if u.Host != "" {
+		return u.Host
+	}
+
+	value := strings.ToLower(uri)
+	if u.Scheme != "" {
+		value = strings.ToLower(u.Scheme)
+	}
+	if blockedValues[value] {
+		return value
+	}
+	return "other"
+}
@@ -0,0 +1,34 @@
+package cspprometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+func TestReporter(t *testing.T) {
+	r, err := NewPrometheusReporter(prometheus.NewRegistry())
+	require.Nil(t, err)
+
+	reports := []csp.Report{
+		{BlockedURI: "https://cdn.example.com/a.js?v=1", ViolatedDirective: "script-src 'self'"},
+		{BlockedURI: "https://cdn.example.com/b.js", ViolatedDirective: "script-src 'self'"},
+		{BlockedURI: "inline", EffectiveDirective: "style-src-elem", ViolatedDirective: "style-src 'self'"},
+		{BlockedURI: "data:image/png;base64,AAAA", ViolatedDirective: "img-src 'self'"},
+		{BlockedURI: "random-1234", ViolatedDirective: "img-src 'self'"},
+		{BlockedURI: "x-custom:thing", ViolatedDirective: "img-src 'self'"},
+	}
+	for _, v := range reports {
+		require.Nil(t, r.Report(v))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(r.violations.WithLabelValues("script-src", "cdn.example.com")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.violations.WithLabelValues("style-src-elem", "inline")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.violations.WithLabelValues("img-src", "data")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(r.violations.WithLabelValues("img-src", "other")))
+}
@@ -0,0 +1,17 @@
+// Package csptest provides utilities for testing CSP protected handlers
+package csptest
+
+import (
+	csp "github.com/ryankurte/go-csp"
+)
+
+// TestPolicyText is the marshaled form of TestPolicy
+const TestPolicyText = "default-src 'none'; script-src 'self'"
+
+// TestPolicy returns a small, valid and known policy for use in tests
+func TestPolicy() csp.CSP {
+	return csp.CSP{
+		DefaultSrc: csp.NewSourceList(csp.SourceNone),
+		ScriptSrc:  csp.NewSourceList(csp.SourceSelf),
+	}
+}
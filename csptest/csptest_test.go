@@ -0,0 +1,47 @@
+package csptest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+func TestCSPTest(t *testing.T) {
+
+	t.Run("Marshal test policy", func(t *testing.T) {
+		p := TestPolicy()
+		txt, err := p.MarshalText()
+		require.Nil(t, err)
+		assert.EqualValues(t, TestPolicyText, string(txt))
+	})
+
+}
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder()
+
+	strict := TestPolicy()
+	relaxed := csp.Default()
+	relaxed.ReportOnly = true
+
+	mux := http.NewServeMux()
+	mux.Handle("/strict", strict.Handler(http.NotFoundHandler()))
+	mux.Handle("/relaxed", relaxed.Handler(http.NotFoundHandler()))
+	h := rec.Handler(mux)
+
+	for _, p := range []string{"/strict", "/relaxed", "/strict"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+
+	assert.EqualValues(t, []string{"/relaxed", "/strict"}, rec.Paths())
+	assert.EqualValues(t, []string{TestPolicyText, TestPolicyText}, rec.Policies("/strict"))
+	assert.EqualValues(t, []Emitted{{ReportOnly: csp.DefaultPolicy}}, rec.Emitted("/relaxed"))
+
+	rec.Reset()
+	assert.Empty(t, rec.Paths())
+}
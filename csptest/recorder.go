@@ -0,0 +1,106 @@
+package csptest
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	csp "github.com/ryankurte/go-csp"
+)
+
+// Emitted holds the CSP headers emitted with a single response
+type Emitted struct {
+	Policy     string // Policy is the Content-Security-Policy header value
+	ReportOnly string // ReportOnly is the Content-Security-Policy-Report-Only header value
+}
+
+// Recorder records the CSP headers emitted by a handler, keyed by request path
+type Recorder struct {
+	mu      sync.Mutex
+	emitted map[string][]Emitted
+}
+
+// NewRecorder creates a new, empty, recorder
+func NewRecorder() *Recorder {
+	return &Recorder{emitted: make(map[string][]Emitted)}
+}
+
+// Handler wraps an http.Handler (typically a CSP protected handler), recording the CSP headers sent with each response
+func (rec *Recorder) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recordingWriter{ResponseWriter: w}
+		h.ServeHTTP(rw, r)
+		rw.capture()
+
+		rec.mu.Lock()
+		rec.emitted[r.URL.Path] = append(rec.emitted[r.URL.Path], rw.emitted)
+		rec.mu.Unlock()
+	})
+}
+
+// Emitted returns the headers recorded for a path, in request order
+func (rec *Recorder) Emitted(path string) []Emitted {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return append([]Emitted{}, rec.emitted[path]...)
+}
+
+// Policies returns the Content-Security-Policy headers recorded for a path, in request order
+func (rec *Recorder) Policies(path string) []string {
+	emitted := rec.Emitted(path)
+	policies := make([]string, len(emitted))
+	for i, e := range emitted {
+		policies[i] = e.Policy
+	}
+	return policies
+}
+
+// Paths returns the sorted list of paths with recorded responses
+func (rec *Recorder) Paths() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	paths := make([]string, 0, len(rec.emitted))
+	for p := range rec.emitted {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Reset clears all recorded headers
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.emitted = make(map[string][]Emitted)
+}
+
+// recordingWriter captures CSP headers at the point they are written to the client
+type recordingWriter struct {
+	http.ResponseWriter
+	captured bool
+	emitted  Emitted
+}
+
+func (rw *recordingWriter) capture() {
+	if rw.captured {
+		return
+	}
+	rw.captured = true
+	rw.emitted = Emitted{
+		Policy:     rw.Header().Get(csp.HeaderPolicy),
+		ReportOnly: rw.Header().Get(csp.HeaderReportOnly),
+	}
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	rw.capture()
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.capture()
+	return rw.ResponseWriter.Write(b)
+}
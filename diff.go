@@ -0,0 +1,65 @@
+package csp
+
+import "sort"
+
+// DirectiveChange describes the sources added to and removed from a directive between two policies
+type DirectiveChange struct {
+	Directive string
+	Added     SourceList
+	Removed   SourceList
+}
+
+// Diff compares two policies, returning the changes to each directive for reviewing policy updates
+// Changes are ordered by directive in marshal order, with unknown directives last in name order.
+func Diff(prev, next CSP) []DirectiveChange {
+	changes := make([]DirectiveChange, 0)
+	compare := func(name string, p, n SourceList) {
+		c := DirectiveChange{name, n.difference(p), p.difference(n)}
+		if len(c.Added) != 0 || len(c.Removed) != 0 {
+			changes = append(changes, c)
+		}
+	}
+
+	prevDirectives := prev.directives()
+	for i, d := range next.directives() {
+		compare(d.name, *prevDirectives[i].sources, *d.sources)
+	}
+
+	compare(webRTC, scalarSource(prev.WebRTC), scalarSource(next.WebRTC))
+	compare(reportURI, scalarSource(prev.ReportURI), scalarSource(next.ReportURI))
+	compare(reportTo, scalarSource(prev.ReportTo), scalarSource(next.ReportTo))
+
+	extra := make([]string, 0, len(prev.Extra)+len(next.Extra))
+	for _, m := range []map[string]SourceList{prev.Extra, next.Extra} {
+		for k := range m {
+			if !SourceList(extra).Contains(k) {
+				extra = append(extra, k)
+			}
+		}
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		compare(k, prev.Extra[k], next.Extra[k])
+	}
+
+	return changes
+}
+
+// scalarSource wraps a single valued setting as a source list for comparison
+func scalarSource(v string) SourceList {
+	if v == "" {
+		return nil
+	}
+	return SourceList{v}
+}
+
+// difference returns the sources in the list that are not in the other list, preserving order
+func (s SourceList) difference(other SourceList) SourceList {
+	var d SourceList
+	for _, v := range s {
+		if !other.Contains(v) {
+			d = append(d, v)
+		}
+	}
+	return d
+}
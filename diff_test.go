@@ -0,0 +1,32 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+
+	t.Run("Identical policies have no changes", func(t *testing.T) {
+		assert.Len(t, Diff(Default(), Default()), 0)
+	})
+
+	t.Run("Added and removed sources", func(t *testing.T) {
+		prev := Default()
+		prev.ImgSrc = NewSourceList(SourceSelf, "img.example.com", SchemeData)
+
+		next := Default()
+		next.ScriptSrc = NewSourceList(SourceSelf, "cdn.example.com")
+		next.ImgSrc = NewSourceList(SourceSelf, SchemeData)
+		next.ReportTo = "csp-endpoint"
+		next.Extra = map[string]SourceList{"sandbox": {"allow-scripts"}}
+
+		assert.EqualValues(t, []DirectiveChange{
+			{Directive: imgSrc, Removed: SourceList{"img.example.com"}},
+			{Directive: scriptSrc, Added: SourceList{"cdn.example.com"}},
+			{Directive: reportTo, Added: SourceList{"csp-endpoint"}},
+			{Directive: "sandbox", Added: SourceList{"allow-scripts"}},
+		}, Diff(prev, next))
+	})
+}
@@ -0,0 +1,72 @@
+package csp
+
+import (
+	"strings"
+)
+
+// frameworkRule describes a source a framework requires in a directive to function
+type frameworkRule struct {
+	directive string
+	source    string
+	message   string
+}
+
+// frameworkRules maps framework names to the sources they commonly require
+var frameworkRules = map[string][]frameworkRule{
+	"angular": {
+		{styleSrc, SourceUnsafeInline, "Angular injects component styles inline, add 'unsafe-inline' or configure a nonce via ngCspNonce"},
+	},
+	"react": {
+		{scriptSrc, SourceUnsafeEval, "React development builds use eval for source maps and hot reloading, add 'unsafe-eval' in development only"},
+	},
+	"vue": {
+		{scriptSrc, SourceUnsafeEval, "Vue's full build compiles templates at runtime with new Function, add 'unsafe-eval' or use the runtime-only build"},
+	},
+	"styled-components": {
+		{styleSrc, SourceUnsafeInline, "styled-components injects styles at runtime, add 'unsafe-inline' or provide a nonce"},
+	},
+	"emotion": {
+		{styleSrc, SourceUnsafeInline, "emotion injects styles at runtime, add 'unsafe-inline' or provide a nonce"},
+	},
+}
+
+// FrameworkWarnings checks a policy for directives likely to break the named framework
+// (one of angular, react, vue, styled-components or emotion), returning advisory warnings.
+// These checks are opinionated and reflect common setups, unknown frameworks return no warnings.
+func (c CSP) FrameworkWarnings(framework string) []Warning {
+	warnings := make([]Warning, 0)
+
+	for _, r := range frameworkRules[strings.ToLower(framework)] {
+		sources := *c.sourceList(r.directive)
+		if len(sources) == 0 {
+			sources = c.DefaultSrc
+		}
+
+		if sources.Contains(r.source) {
+			continue
+		}
+		// Inline content may instead be allowed by nonces or hashes
+		if r.source == SourceUnsafeInline && sources.hasNonceOrHash() {
+			continue
+		}
+
+		warnings = append(warnings, Warning{r.directive, r.message, SeverityMedium})
+	}
+
+	return warnings
+}
+
+// hasNonceOrHash checks whether a source list contains any nonce or hash sources
+func (s SourceList) hasNonceOrHash() bool {
+	for _, v := range s {
+		if v == NoncePlaceholder {
+			return true
+		}
+		for _, p := range quotedPrefixes {
+			if strings.HasPrefix(v, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,401 @@
+package csp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultPolicy is the precomputed marshaled form of the Default() policy
+const DefaultPolicy = "default-src 'none'; connect-src 'self'; img-src 'self'; script-src 'self'; style-src 'self'"
+
+// defaultHandler attaches the precomputed Default() policy header to all requests
+type defaultHandler struct {
+	h http.Handler
+}
+
+// ServeHTTP is an http.Handler instance that attaches the Default() CSP header to all requests
+func (d *defaultHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderPolicy, DefaultPolicy)
+	d.h.ServeHTTP(w, r)
+}
+
+// DefaultHandler wraps an http.Handler with the Default() policy
+// This is equivalent to Default().Handler(h), but serves the precomputed DefaultPolicy rather than
+// marshaling the policy for each request.
+func DefaultHandler(h http.Handler) http.Handler {
+	return &defaultHandler{h}
+}
+
+// bufferPool holds buffers for marshaling policies per request
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// cspHandler wraps a snapshot of a CSP configuration providing an http.Handler interface
+// and wrapping an underlying handler
+type cspHandler struct {
+	policy CSP
+	h      http.Handler
+}
+
+// ServeHTTP is an http.Handler instance that attaches CSP headers to all requests
+// Headers are set before the wrapped handler is called so they are sent however early it writes the response,
+// wrapped handlers should use NonceFromContext rather than modifying the policy header.
+// A policy attached to the request context with WithPolicy is used in place of the handler policy.
+// With HTMLOnly or SkipStatus set headers are instead attached when the response is first written, see deferredWriter.
+func (c *cspHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	servePolicy(&c.policy, c.h, w, r)
+}
+
+// servePolicy attaches the headers for a policy and calls the wrapped handler, see cspHandler.ServeHTTP
+// The policy must not be modified, per-request changes are made to a copy.
+func servePolicy(p *CSP, h http.Handler, w http.ResponseWriter, r *http.Request) {
+	if cp, ok := r.Context().Value(policyKey{}).(CSP); ok {
+		p = &cp
+	}
+
+	key := HeaderPolicy
+	if p.ReportOnly {
+		key = HeaderReportOnly
+	}
+
+	servePolicies([]*CSP{p}, []string{key}, h, w, r)
+}
+
+// servePolicies attaches each policy under the corresponding header key and calls the wrapped handler,
+// generating a single nonce shared by all policies where required. The policies must not be modified.
+func servePolicies(policies []*CSP, keys []string, h http.Handler, w http.ResponseWriter, r *http.Request) {
+	nonce, source := "", ""
+	for _, p := range policies {
+		if nonce == "" && (p.Nonce || p.hasNoncePlaceholder()) {
+			var err error
+			nonce, source, err = GenerateNonce()
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+		}
+	}
+
+	headers := make([]policyHeader, len(policies))
+	deferred := false
+	for i, p := range policies {
+		placeholder := p.hasNoncePlaceholder()
+		if p.Nonce || placeholder {
+			// Add the nonce to a copy of the policy so the shared configuration is not modified
+			n := p.clone()
+			if placeholder {
+				n.replaceSource(NoncePlaceholder, source)
+			}
+			if p.Nonce {
+				// Directives are checked by nonceDirectives, so this cannot fail
+				_ = n.addNonceSource(source, p.nonceDirectives(), true)
+			}
+			p = &n
+		}
+
+		buf := bufferPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		p.MarshalTextTo(buf)
+		val := buf.String()
+		bufferPool.Put(buf)
+
+		groups, err := p.reportToGroups()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		headers[i] = policyHeader{keys[i], val, groups, p.HTMLOnly, p.SkipStatus}
+		deferred = deferred || p.HTMLOnly || len(p.SkipStatus) != 0
+	}
+
+	if deferred {
+		w = &deferredWriter{ResponseWriter: w, headers: headers}
+	} else {
+		setPolicyHeaders(w.Header(), headers)
+	}
+
+	h.ServeHTTP(w, r)
+}
+
+// policyHeader is a marshaled policy header with the Report-To groups and options controlling where it is attached
+type policyHeader struct {
+	key, value string
+	reportTo   []string
+	htmlOnly   bool
+	skipStatus []int
+}
+
+// setPolicyHeaders sets the policy headers, with a Report-To header combining the groups of each
+func setPolicyHeaders(header http.Header, headers []policyHeader) {
+	groups := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, p := range headers {
+		header.Set(p.key, p.value)
+		for _, g := range p.reportTo {
+			if !seen[g] {
+				seen[g] = true
+				groups = append(groups, g)
+			}
+		}
+	}
+	if len(groups) != 0 {
+		header.Set(HeaderReportTo, strings.Join(groups, ", "))
+	}
+}
+
+// nonceDirectives returns the valid NonceDirectives, defaulting to script-src where none are set
+func (c *CSP) nonceDirectives() []string {
+	directives := make([]string, 0, len(c.NonceDirectives))
+	for _, d := range c.NonceDirectives {
+		if validateNonceDirective(d) == nil {
+			directives = append(directives, d)
+		}
+	}
+	if len(directives) == 0 {
+		directives = append(directives, scriptSrc)
+	}
+	return directives
+}
+
+// handlerPolicy copies a policy for serving, logging and removing invalid NonceDirectives once
+// rather than failing each request
+func handlerPolicy(c *CSP) CSP {
+	n := c.clone()
+	for _, d := range n.NonceDirectives {
+		if err := validateNonceDirective(d); err != nil {
+			log.Printf("CSP handler ignoring nonce directive: %v", err)
+		}
+	}
+	if len(n.NonceDirectives) != 0 {
+		n.NonceDirectives = n.nonceDirectives()
+	}
+	return n
+}
+
+// deferredWriter wraps a ResponseWriter, attaching the policy and Report-To headers once the response status and content type are known
+// Rather than buffering the response, these are checked when the status is written (or the body first written,
+// where the content type is detected from the body as by net/http). Handlers must therefore set the Content-Type
+// before calling WriteHeader for non-sniffable responses, or HTML only policy headers are omitted.
+type deferredWriter struct {
+	http.ResponseWriter
+	headers []policyHeader
+	checked bool
+}
+
+// check attaches each header unless excluded by the response status or content type
+func (d *deferredWriter) check(status int, body []byte) {
+	if d.checked {
+		return
+	}
+	d.checked = true
+
+	contentType := d.Header().Get("Content-Type")
+	if contentType == "" && body != nil {
+		contentType = http.DetectContentType(body)
+	}
+
+	attached := make([]policyHeader, 0, len(d.headers))
+	for _, p := range d.headers {
+		if !skipResponse(status, contentType, p.htmlOnly, p.skipStatus) {
+			attached = append(attached, p)
+		}
+	}
+	setPolicyHeaders(d.Header(), attached)
+}
+
+// skipResponse checks whether policy headers are omitted for a response status and content type per HTMLOnly and SkipStatus
+func skipResponse(status int, contentType string, htmlOnly bool, skipStatus []int) bool {
+	for _, s := range skipStatus {
+		if s == status {
+			return true
+		}
+	}
+
+	if htmlOnly {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "text/html" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteHeader attaches the header where applicable, then writes the status code
+func (d *deferredWriter) WriteHeader(status int) {
+	d.check(status, nil)
+	d.ResponseWriter.WriteHeader(status)
+}
+
+// Write attaches the header where applicable on the first write, then writes the body
+func (d *deferredWriter) Write(b []byte) (int, error) {
+	d.check(http.StatusOK, b)
+	return d.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher where supported by the underlying writer
+func (d *deferredWriter) Flush() {
+	d.check(http.StatusOK, nil)
+	if f, ok := d.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for use with http.ResponseController
+func (d *deferredWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// Handler wraps an http.Handler in a CSP instance
+// The handler holds a copy of the policy, so later changes to the CSP instance do not affect existing handlers
+// and handlers are safe for concurrent use. Invalid NonceDirectives are logged and ignored.
+func (c *CSP) Handler(h http.Handler) http.Handler {
+	return &cspHandler{handlerPolicy(c), h}
+}
+
+// ServeNext returns a function attaching the policy headers as for Handler before calling next, for middleware
+// frameworks providing the next handler per request (eg. negroni). As with Handler this holds a copy of the policy.
+func (c *CSP) ServeNext() func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	p := handlerPolicy(c)
+	return func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		servePolicy(&p, next, w, r)
+	}
+}
+
+// ReloadHandler is an http.Handler serving a policy that may be replaced at runtime (eg. on configuration reload)
+// Policies are swapped atomically, so requests are served with either the previous or the new policy.
+type ReloadHandler struct {
+	policy atomic.Pointer[CSP]
+	h      http.Handler
+}
+
+// NewReloadHandler wraps an http.Handler, serving a copy of the policy until replaced with Swap
+func NewReloadHandler(c CSP, h http.Handler) *ReloadHandler {
+	r := &ReloadHandler{h: h}
+	r.Swap(c)
+	return r
+}
+
+// Swap replaces the served policy with a copy of the provided policy, returning the previous policy
+func (r *ReloadHandler) Swap(c CSP) CSP {
+	n := handlerPolicy(&c)
+	if prev := r.policy.Swap(&n); prev != nil {
+		return *prev
+	}
+	return CSP{}
+}
+
+// ServeHTTP attaches the current policy headers as for Handler, then calls the wrapped handler
+func (r *ReloadHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	servePolicy(r.policy.Load(), r.h, w, req)
+}
+
+// dualHandler wraps enforced and report only CSP configurations providing an http.Handler interface
+// and wrapping an underlying handler
+type dualHandler struct {
+	enforced   CSP
+	reportOnly CSP
+	h          http.Handler
+}
+
+// ServeHTTP is an http.Handler instance that attaches both enforced and report only CSP headers to all requests
+// Nonces and placeholders are handled as for Handler, with a single nonce shared by both policies.
+func (d *dualHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	servePolicies([]*CSP{&d.enforced, &d.reportOnly}, []string{HeaderPolicy, HeaderReportOnly}, d.h, w, r)
+}
+
+// DualHandler wraps an http.Handler, enforcing one policy while reporting against another
+// This allows a stricter policy to be trialled in production alongside the current policy,
+// the ReportOnly flag of each policy is ignored. As with Handler the handler holds copies of the policies.
+func DualHandler(enforced, reportOnly CSP, h http.Handler) http.Handler {
+	return &dualHandler{handlerPolicy(&enforced), handlerPolicy(&reportOnly), h}
+}
+
+// policyKey is the context key for per-request policies
+type policyKey struct{}
+
+// WithPolicy attaches a policy to a context, for middleware selecting the policy served by Handler per request
+// (eg. a stricter policy for admin pages). This must be applied before the request reaches the CSP handler.
+func WithPolicy(ctx context.Context, c CSP) context.Context {
+	return context.WithValue(ctx, policyKey{}, c)
+}
+
+// NoncePlaceholder is replaced with the per-request nonce source (eg. 'nonce-abc123') in policies served by Handler
+// This allows policies loaded from configuration to position the nonce, eg. "script-src 'self' {nonce}",
+// and a nonce is generated for policies containing the placeholder whether or not Nonce is set.
+var NoncePlaceholder = "{nonce}"
+
+// hasNoncePlaceholder checks whether any directive contains the NoncePlaceholder
+func (c *CSP) hasNoncePlaceholder() bool {
+	for _, d := range c.directives() {
+		if d.sources.Contains(NoncePlaceholder) {
+			return true
+		}
+	}
+	for _, v := range c.Extra {
+		if v.Contains(NoncePlaceholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceSource replaces all occurrences of a source in place, the policy must not share source lists (see clone)
+func (c *CSP) replaceSource(from, to string) {
+	lists := make([]SourceList, 0)
+	for _, d := range c.directives() {
+		lists = append(lists, *d.sources)
+	}
+	for _, v := range c.Extra {
+		lists = append(lists, v)
+	}
+
+	for _, l := range lists {
+		for i, v := range l {
+			if v == from {
+				l[i] = to
+			}
+		}
+	}
+}
+
+// nonceKey is the context key for per-request nonces
+type nonceKey struct{}
+
+// NonceFromContext fetches the nonce generated by Handler for a request, for use in script nonce attributes
+// This returns an empty string where no nonce was generated.
+func NonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey{}).(string)
+	return nonce
+}
+
+// NonceFuncs returns template functions for a request context, with cspNonce returning the request nonce
+// Templates should be parsed with NonceFuncs(context.Background()) so cspNonce is defined, then cloned per request
+// with the request functions, eg. t.Clone() followed by Funcs(NonceFuncs(r.Context())), to render
+// <script nonce="{{ cspNonce }}">. Alternatively pass NonceFromContext(r.Context()) in the template data.
+func NonceFuncs(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string { return NonceFromContext(ctx) },
+	}
+}
+
+// GenerateNonce generates a base64 encoded 128 bit random nonce, returning both the raw value
+// for template nonce attributes and the 'nonce-<raw>' source for the policy header
+func GenerateNonce() (raw string, source string, err error) {
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	raw = base64.StdEncoding.EncodeToString(b)
+	return raw, "'nonce-" + raw + "'", nil
+}
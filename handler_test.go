@@ -0,0 +1,369 @@
+package csp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nonceHandler writes the request nonce to the response body
+var nonceHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(NonceFromContext(r.Context())))
+})
+
+func TestHandler(t *testing.T) {
+
+	t.Run("Strict policy", func(t *testing.T) {
+		c := Strict()
+		txt, err := c.MarshalText()
+		require.Nil(t, err)
+		assert.EqualValues(t, "object-src 'none'; script-src 'strict-dynamic'; base-uri 'none'; require-trusted-types-for 'script'", string(txt))
+	})
+
+	t.Run("Headers sent with early writes", func(t *testing.T) {
+		c := Strict()
+		h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(NonceFromContext(r.Context())))
+		}))
+
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get(HeaderPolicy), fmt.Sprintf("script-src 'nonce-%s'", body))
+	})
+
+	t.Run("Policy selected from context", func(t *testing.T) {
+		c := Default()
+		h := c.Handler(nonceHandler)
+
+		admin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/admin" {
+				r = r.WithContext(WithPolicy(r.Context(), Strict()))
+			}
+			h.ServeHTTP(w, r)
+		})
+
+		rw := httptest.NewRecorder()
+		admin.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy))
+		assert.Empty(t, rw.Body.String())
+
+		rw = httptest.NewRecorder()
+		admin.ServeHTTP(rw, httptest.NewRequest("GET", "/admin", nil))
+		assert.Contains(t, rw.Header().Get(HeaderPolicy), fmt.Sprintf("script-src 'nonce-%s' 'strict-dynamic'", rw.Body.String()))
+		assert.Len(t, rw.Body.String(), 24)
+	})
+
+	t.Run("Nonce placeholder substituted per request", func(t *testing.T) {
+		c := CSP{}
+		err := c.UnmarshalText([]byte("script-src 'self' {nonce}; style-src {nonce}"))
+		require.Nil(t, err)
+		require.Nil(t, c.Validate())
+		h := c.Handler(nonceHandler)
+
+		nonces := make(map[string]bool)
+		for i := 0; i < 2; i++ {
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+			nonce := rw.Body.String()
+			assert.Len(t, nonce, 24)
+			assert.Equal(t, fmt.Sprintf("script-src 'self' 'nonce-%s'; style-src 'nonce-%s'", nonce, nonce), rw.Header().Get(HeaderPolicy))
+			nonces[nonce] = true
+		}
+		assert.Len(t, nonces, 2)
+		assert.EqualValues(t, NewSourceList(SourceSelf, NoncePlaceholder), c.ScriptSrc)
+	})
+
+	t.Run("HTML only policy", func(t *testing.T) {
+		c := Default()
+		c.HTMLOnly = true
+
+		responses := map[string]http.HandlerFunc{
+			"html": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+			},
+			"sniffed": func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("<!DOCTYPE html><html></html>"))
+			},
+			"json": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte("<html>"))
+			},
+		}
+
+		for name, f := range responses {
+			rw := httptest.NewRecorder()
+			c.Handler(f).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+			if name == "json" {
+				assert.Empty(t, rw.Header().Get(HeaderPolicy), name)
+			} else {
+				assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy), name)
+			}
+		}
+	})
+
+	t.Run("Skip status codes", func(t *testing.T) {
+		c := Default()
+		c.SkipStatus = []int{http.StatusNotModified}
+
+		for status, expected := range map[int]string{
+			http.StatusOK:          DefaultPolicy,
+			http.StatusFound:       DefaultPolicy,
+			http.StatusNotModified: "",
+		} {
+			h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(t, status, rw.Code)
+			assert.Equal(t, expected, rw.Header().Get(HeaderPolicy), status)
+		}
+	})
+
+	t.Run("Skipped responses omit Report-To", func(t *testing.T) {
+		c := Default()
+		c.SkipStatus = []int{http.StatusNotModified}
+		c.AddReportingGroup(ReportingGroup{"csp-endpoint", "https://example.com/reports", 3600})
+		groups, err := c.ReportToHeader()
+		require.Nil(t, err)
+
+		for status, expected := range map[int]string{
+			http.StatusOK:          groups,
+			http.StatusNotModified: "",
+		} {
+			h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(t, expected, rw.Header().Get(HeaderReportTo), status)
+		}
+	})
+
+	t.Run("Reset policy does not affect handlers", func(t *testing.T) {
+		c := Strict()
+		c.WithReporting("/_/csp-reports", "csp-endpoint")
+		c.Extra = map[string]SourceList{"upgrade-insecure-requests": {}}
+		h := c.Handler(nonceHandler)
+
+		c.Reset()
+		assert.EqualValues(t, CSP{}, c)
+
+		c.DefaultSrc = NewSourceList(SourceSelf)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Contains(t, rw.Header().Get(HeaderPolicy), "object-src 'none'; script-src 'nonce-")
+		assert.Len(t, rw.Body.String(), 24)
+	})
+
+	t.Run("Reload handler policy", func(t *testing.T) {
+		c := Default()
+		h := NewReloadHandler(c, nonceHandler)
+
+		c.ImgSrc = NewSourceList("img.example.com")
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy))
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			}()
+		}
+
+		prev := h.Swap(Strict())
+		wg.Wait()
+		assert.EqualValues(t, Default(), prev)
+
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Contains(t, rw.Header().Get(HeaderPolicy), "script-src 'nonce-"+rw.Body.String()+"' 'strict-dynamic'")
+	})
+
+	t.Run("Handlers are safe for concurrent use", func(t *testing.T) {
+		c := Strict()
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h := c.Handler(nonceHandler)
+				for j := 0; j < 8; j++ {
+					rw := httptest.NewRecorder()
+					h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+					assert.Contains(t, rw.Header().Get(HeaderPolicy), rw.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Changes to the policy do not affect existing handlers
+		h := c.Handler(nonceHandler)
+		c.ScriptSrc[0] = "cdn.example.com"
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.Contains(t, rw.Header().Get(HeaderPolicy), "'strict-dynamic'")
+		assert.NotContains(t, rw.Header().Get(HeaderPolicy), "cdn.example.com")
+	})
+
+	t.Run("Nonce generated per request", func(t *testing.T) {
+		c := Strict()
+		h := c.Handler(nonceHandler)
+
+		nonces := make([]string, 0)
+		for i := 0; i < 2; i++ {
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+			nonce := rw.Body.String()
+			assert.Len(t, nonce, 24)
+			assert.Contains(t, rw.Header().Get(HeaderPolicy), fmt.Sprintf("script-src 'nonce-%s' 'strict-dynamic'", nonce))
+			nonces = append(nonces, nonce)
+		}
+
+		assert.NotEqual(t, nonces[0], nonces[1])
+		assert.EqualValues(t, NewSourceList(SourceStrictDynamic), c.ScriptSrc)
+	})
+
+	t.Run("Nonce added to configured directives", func(t *testing.T) {
+		c := Strict()
+		c.StyleSrc = NewSourceList(SourceSelf)
+		c.NonceDirectives = []string{scriptSrc, styleSrc}
+
+		rw := httptest.NewRecorder()
+		c.Handler(nonceHandler).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		nonce := rw.Body.String()
+		policy := rw.Header().Get(HeaderPolicy)
+		assert.Contains(t, policy, fmt.Sprintf("script-src 'nonce-%s' 'strict-dynamic'", nonce))
+		assert.Contains(t, policy, fmt.Sprintf("style-src 'nonce-%s' 'self'", nonce))
+		assert.EqualValues(t, NewSourceList(SourceSelf), c.StyleSrc)
+	})
+
+	t.Run("Invalid nonce directives are ignored", func(t *testing.T) {
+		c := Strict()
+		c.NonceDirectives = []string{baseURI, scriptSrc}
+
+		for _, h := range []http.Handler{c.Handler(nonceHandler), NewReloadHandler(c, nonceHandler)} {
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+			nonce := rw.Body.String()
+			require.Len(t, nonce, 24)
+			assert.Contains(t, rw.Header().Get(HeaderPolicy), fmt.Sprintf("script-src 'nonce-%s' 'strict-dynamic'", nonce))
+			assert.NotContains(t, rw.Header().Get(HeaderPolicy), "base-uri 'nonce-")
+		}
+	})
+
+	t.Run("Nonce added to default-src fallback", func(t *testing.T) {
+		c := CSP{DefaultSrc: NewSourceList(SourceSelf), Nonce: true}
+
+		rw := httptest.NewRecorder()
+		c.Handler(nonceHandler).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, fmt.Sprintf("default-src 'self'; script-src 'nonce-%s' 'self'", rw.Body.String()), rw.Header().Get(HeaderPolicy))
+	})
+
+	t.Run("Dual handler shares nonce and reporting groups", func(t *testing.T) {
+		enforced := Strict()
+		enforced.ReportTo = "csp"
+		enforced.ReportingGroups = []ReportingGroup{{Name: "csp", Endpoint: "https://example.com/csp", MaxAge: 60}}
+		reportOnly := CSP{DefaultSrc: NewSourceList(SourceSelf), ScriptSrc: NewSourceList(NoncePlaceholder), SkipStatus: []int{http.StatusNotFound}}
+
+		h := DualHandler(enforced, reportOnly, nonceHandler)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		nonce := rw.Body.String()
+		require.Len(t, nonce, 24)
+		assert.Contains(t, rw.Header().Get(HeaderPolicy), fmt.Sprintf("script-src 'nonce-%s' 'strict-dynamic'", nonce))
+		assert.Equal(t, fmt.Sprintf("default-src 'self'; script-src 'nonce-%s'", nonce), rw.Header().Get(HeaderReportOnly))
+		assert.Equal(t, `{"group":"csp","max_age":60,"endpoints":[{"url":"https://example.com/csp"}]}`, rw.Header().Get(HeaderReportTo))
+
+		rw = httptest.NewRecorder()
+		DualHandler(enforced, reportOnly, http.NotFoundHandler()).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		assert.NotEmpty(t, rw.Header().Get(HeaderPolicy))
+		assert.Empty(t, rw.Header().Get(HeaderReportOnly))
+		assert.NotEmpty(t, rw.Header().Get(HeaderReportTo))
+	})
+
+	t.Run("Serve next handler", func(t *testing.T) {
+		c := Strict()
+		serve := c.ServeNext()
+		c.Nonce = false
+
+		rw := httptest.NewRecorder()
+		serve(rw, httptest.NewRequest("GET", "/", nil), nonceHandler)
+
+		assert.Len(t, rw.Body.String(), 24)
+		assert.Contains(t, rw.Header().Get(HeaderPolicy), fmt.Sprintf("'nonce-%s'", rw.Body.String()))
+	})
+
+	t.Run("No nonce without Nonce option", func(t *testing.T) {
+		c := Default()
+		rw := httptest.NewRecorder()
+		c.Handler(nonceHandler).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		assert.Empty(t, rw.Body.String())
+		assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy))
+	})
+
+	t.Run("Generate nonce", func(t *testing.T) {
+		raw, source, err := GenerateNonce()
+		require.Nil(t, err)
+
+		b, err := base64.StdEncoding.DecodeString(raw)
+		require.Nil(t, err)
+		assert.Len(t, b, 16)
+		assert.Equal(t, "'nonce-"+raw+"'", source)
+
+		raw2, _, err := GenerateNonce()
+		require.Nil(t, err)
+		assert.NotEqual(t, raw, raw2)
+	})
+}
+
+func ExampleNonceFuncs() {
+	base := template.Must(template.New("page").Funcs(NonceFuncs(context.Background())).Parse(`<script nonce="{{ cspNonce }}"></script>`))
+
+	c := Strict()
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := template.Must(base.Clone()).Funcs(NonceFuncs(r.Context()))
+		t.Execute(w, nil)
+	}))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+	policy := rw.Header().Get(HeaderPolicy)
+	nonce := policy[strings.Index(policy, "'nonce-")+7:][:24]
+	fmt.Println(html.UnescapeString(rw.Body.String()) == `<script nonce="`+nonce+`"></script>`)
+	// Output: true
+}
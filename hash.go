@@ -0,0 +1,46 @@
+package csp
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+)
+
+// HashAlgo is a hash algorithm supported for CSP hash sources and subresource integrity
+type HashAlgo string
+
+// Supported hash algorithms
+const (
+	HashSHA256 HashAlgo = "sha256"
+	HashSHA384 HashAlgo = "sha384"
+	HashSHA512 HashAlgo = "sha512"
+)
+
+// newHash creates a hash for the algorithm, returning nil for unsupported algorithms
+func (a HashAlgo) newHash() hash.Hash {
+	switch a {
+	case HashSHA256:
+		return sha256.New()
+	case HashSHA384:
+		return sha512.New384()
+	case HashSHA512:
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+// IntegrityAndSource hashes content, returning both the SRI integrity attribute value (eg. sha256-abc=)
+// and the matching CSP hash source (eg. 'sha256-abc='), so inline content and policies always agree.
+// Unsupported algorithms return empty strings.
+func IntegrityAndSource(algo HashAlgo, content []byte) (integrity string, cspSource string) {
+	h := algo.newHash()
+	if h == nil {
+		return "", ""
+	}
+	h.Write(content)
+
+	integrity = string(algo) + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return integrity, "'" + integrity + "'"
+}
@@ -0,0 +1,33 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrityAndSource(t *testing.T) {
+	content := []byte("alert('Hello, world.');")
+
+	t.Run("SHA256 fixture", func(t *testing.T) {
+		integrity, source := IntegrityAndSource(HashSHA256, content)
+		assert.Equal(t, "sha256-qznLcsROx4GACP2dm0UCKCzCG+HiZ1guq6ZZDob/Tng=", integrity)
+		assert.Equal(t, "'sha256-qznLcsROx4GACP2dm0UCKCzCG+HiZ1guq6ZZDob/Tng='", source)
+		assert.Nil(t, ValidateSource(source))
+	})
+
+	t.Run("Other algorithms", func(t *testing.T) {
+		for algo, length := range map[HashAlgo]int{HashSHA384: 64, HashSHA512: 88} {
+			integrity, source := IntegrityAndSource(algo, content)
+			assert.Len(t, integrity, len(algo)+1+length)
+			assert.Equal(t, "'"+integrity+"'", source)
+			assert.Nil(t, ValidateSource(source))
+		}
+	})
+
+	t.Run("Unsupported algorithm", func(t *testing.T) {
+		integrity, source := IntegrityAndSource("md5", content)
+		assert.Empty(t, integrity)
+		assert.Empty(t, source)
+	})
+}
@@ -0,0 +1,302 @@
+package csp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks the impact of a policy weakness
+type Severity int
+
+// Warning severities, in increasing order of impact
+const (
+	SeverityLow    Severity = iota // SeverityLow indicates redundant or ineffective sources
+	SeverityMedium                 // SeverityMedium indicates gaps in coverage or compatibility problems
+	SeverityHigh                   // SeverityHigh indicates sources allowing script injection
+)
+
+// String formats a severity for display
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Warning is an advisory message about a potential weakness in a policy
+type Warning struct {
+	Directive string   // Directive the warning applies to
+	Message   string   // Message describes the weakness
+	Severity  Severity // Severity of the weakness
+}
+
+// String formats a warning for display
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Directive, w.Message)
+}
+
+// lintRule checks a policy for a specific weakness
+type lintRule func(c *CSP) []Warning
+
+// lintRules are applied in order when linting a policy
+var lintRules = []lintRule{
+	lintInsecureScheme,
+	lintStrictDynamic,
+	lintDataScripts,
+	lintMissingDefault,
+	lintObjectSrc,
+	lintUnsafeInline,
+	lintPolicySize,
+	lintReportSample,
+	lintUnsafeHashes,
+}
+
+// MaxPolicySize is the marshaled policy size in bytes above which Lint warns the header may be dropped or truncated
+var MaxPolicySize = 8 * 1024
+
+// Lint checks a policy for common weaknesses, returning a list of advisory warnings
+// Unlike validation, a policy with warnings is still well formed and will be applied by browsers.
+func (c CSP) Lint() []Warning {
+	warnings := make([]Warning, 0)
+	for _, r := range lintRules {
+		warnings = append(warnings, r(&c)...)
+	}
+	return warnings
+}
+
+// LintSeverity checks a policy for common weaknesses, returning warnings of at least the provided severity
+// This allows callers to opt into stricter checks, eg. LintSeverity(SeverityHigh) reports only injection risks.
+func (c CSP) LintSeverity(min Severity) []Warning {
+	warnings := make([]Warning, 0)
+	for _, w := range c.Lint() {
+		if w.Severity >= min {
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings
+}
+
+// lintInsecureScheme warns about bare http: scheme sources, which allow any insecure origin
+func lintInsecureScheme(c *CSP) []Warning {
+	warnings := make([]Warning, 0)
+
+	for _, d := range c.directives() {
+		var insecure, secure bool
+		for _, s := range *d.sources {
+			switch strings.ToLower(s) {
+			case SchemeHTTP:
+				insecure = true
+			case SchemeHTTPS:
+				secure = true
+			}
+		}
+
+		if insecure && secure {
+			warnings = append(warnings, Warning{d.name, "http: is redundant alongside https: and allows insecure origins, remove http:", SeverityMedium})
+		} else if insecure {
+			warnings = append(warnings, Warning{d.name, "http: allows any insecure origin, use https: or specific hosts", SeverityMedium})
+		}
+	}
+
+	return warnings
+}
+
+// lintStrictDynamic warns about sources ignored by browsers due to 'strict-dynamic'
+func lintStrictDynamic(c *CSP) []Warning {
+	name, sources := scriptSrc, c.ScriptSrc
+	if len(sources) == 0 {
+		name, sources = defaultSrc, c.DefaultSrc
+	}
+	if !sources.Contains(SourceStrictDynamic) {
+		return nil
+	}
+
+	warnings := make([]Warning, 0)
+
+	ignored := make([]string, 0)
+	for _, s := range sources {
+		if s == SourceSelf || s == SourceUnsafeInline || (!strings.HasPrefix(s, "'") && s != NoncePlaceholder) {
+			ignored = append(ignored, s)
+		}
+	}
+	if len(ignored) != 0 {
+		warnings = append(warnings, Warning{name, fmt.Sprintf("'strict-dynamic' causes %s to be ignored", strings.Join(ignored, ", ")), SeverityLow})
+	}
+
+	if !sources.hasNonceOrHash() && !c.handlerNonce() {
+		warnings = append(warnings, Warning{name, "'strict-dynamic' without a nonce or hash blocks all scripts", SeverityMedium})
+	}
+
+	return warnings
+}
+
+// handlerNonce checks whether Handler adds its per-request nonce to the script directives
+func (c *CSP) handlerNonce() bool {
+	if !c.Nonce {
+		return false
+	}
+	for _, d := range c.nonceDirectives() {
+		if d == scriptSrc || d == defaultSrc {
+			return true
+		}
+	}
+	return false
+}
+
+// lintDataScripts warns about data: sources for scripts, which allow arbitrary script injection
+func lintDataScripts(c *CSP) []Warning {
+	name, sources := scriptSrc, c.ScriptSrc
+	if len(sources) == 0 {
+		name, sources = defaultSrc, c.DefaultSrc
+	}
+
+	for _, s := range sources {
+		if strings.ToLower(s) == SchemeData {
+			return []Warning{{name, "data: allows arbitrary scripts to be injected as data URIs", SeverityHigh}}
+		}
+	}
+
+	return nil
+}
+
+// lintMissingDefault warns about policies without default-src, leaving unset fetch directives unrestricted
+func lintMissingDefault(c *CSP) []Warning {
+	if len(c.DefaultSrc) != 0 {
+		return nil
+	}
+	return []Warning{{defaultSrc, "missing default-src leaves unset fetch directives unrestricted", SeverityMedium}}
+}
+
+// lintObjectSrc warns where object-src (or the default-src fallback) is not 'none', allowing plugin content
+func lintObjectSrc(c *CSP) []Warning {
+	sources := c.ObjectSrc
+	if len(sources) == 0 {
+		sources = c.DefaultSrc
+	}
+	if len(sources) == 1 && sources[0] == SourceNone {
+		return nil
+	}
+	return []Warning{{objectSrc, "object-src should be 'none' to prevent plugin based script injection", SeverityMedium}}
+}
+
+// lintUnsafeInline warns about 'unsafe-inline' scripts without a nonce or hash, which allow inline script injection
+// Browsers supporting nonces and hashes ignore 'unsafe-inline' where these are present.
+func lintUnsafeInline(c *CSP) []Warning {
+	name, sources := scriptSrc, c.ScriptSrc
+	if len(sources) == 0 {
+		name, sources = defaultSrc, c.DefaultSrc
+	}
+	if !sources.Contains(SourceUnsafeInline) || sources.hasNonceOrHash() || c.handlerNonce() {
+		return nil
+	}
+	return []Warning{{name, "'unsafe-inline' without a nonce or hash allows inline script injection", SeverityHigh}}
+}
+
+// lintPolicySize warns about policies exceeding MaxPolicySize, which proxies or browsers may truncate or drop
+func lintPolicySize(c *CSP) []Warning {
+	entries := c.entries()
+	size := len(joinEntries(entries))
+	if size <= MaxPolicySize {
+		return nil
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return len(entries[i].String()) > len(entries[j].String())
+	})
+	if len(entries) > 3 {
+		entries = entries[:3]
+	}
+	largest := make([]string, len(entries))
+	for i, e := range entries {
+		largest[i] = fmt.Sprintf("%s %d bytes", e.name, len(e.String()))
+	}
+
+	return []Warning{{entries[0].name, fmt.Sprintf("policy is %d bytes, exceeding %d bytes, largest directives: %s", size, MaxPolicySize, strings.Join(largest, ", ")), SeverityMedium}}
+}
+
+// reportSampleDirectives are the directives in which 'report-sample' includes code samples in violation reports
+var reportSampleDirectives = map[string]bool{
+	defaultSrc:        true,
+	scriptSrc:         true,
+	"script-src-elem": true,
+	"script-src-attr": true,
+	styleSrc:          true,
+	"style-src-elem":  true,
+	"style-src-attr":  true,
+}
+
+// lintReportSample warns about 'report-sample' in directives other than script and style, where it has no effect
+func lintReportSample(c *CSP) []Warning {
+	warnings := make([]Warning, 0)
+
+	for _, name := range c.directivesWith(SourceReportSample) {
+		if !reportSampleDirectives[name] {
+			warnings = append(warnings, Warning{name, "'report-sample' has no effect outside script and style directives", SeverityLow})
+		}
+	}
+
+	return warnings
+}
+
+// lintUnsafeHashes warns about 'unsafe-hashes', which has no effect without hash sources and otherwise
+// allows matching inline event handlers and javascript: URLs to execute
+func lintUnsafeHashes(c *CSP) []Warning {
+	warnings := make([]Warning, 0)
+
+	for _, name := range c.directivesWith(SourceUnsafeHashes) {
+		if c.lookup(name).hasHash() {
+			warnings = append(warnings, Warning{name, "'unsafe-hashes' allows inline event handlers and javascript: URLs, move handlers to scripts where possible", SeverityMedium})
+		} else {
+			warnings = append(warnings, Warning{name, "'unsafe-hashes' has no effect without hash sources", SeverityLow})
+		}
+	}
+
+	return warnings
+}
+
+// directivesWith lists the directives (including those in Extra) containing a source, in marshal order
+func (c *CSP) directivesWith(source string) []string {
+	names := make([]string, 0)
+	for _, d := range c.directives() {
+		if d.sources.Contains(source) {
+			names = append(names, d.name)
+		}
+	}
+
+	extra := make([]string, 0)
+	for k, v := range c.Extra {
+		if v.Contains(source) {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(extra)
+
+	return append(names, extra...)
+}
+
+// lookup fetches the sources for a named directive, from Extra where it is not a known directive
+func (c *CSP) lookup(name string) SourceList {
+	if l := c.sourceList(name); l != nil {
+		return *l
+	}
+	return c.Extra[name]
+}
+
+// hasHash checks whether a source list contains any hash sources
+func (s SourceList) hasHash() bool {
+	for _, v := range s {
+		for _, a := range []HashAlgo{HashSHA256, HashSHA384, HashSHA512} {
+			if strings.HasPrefix(v, "'"+string(a)+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package csp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+
+	t.Run("Default policy has no warnings", func(t *testing.T) {
+		assert.Empty(t, Default().Lint())
+	})
+
+	t.Run("Warns on http: scheme", func(t *testing.T) {
+		c := Default()
+		c.ImgSrc = NewSourceList(SourceSelf, "http:")
+
+		w := c.Lint()
+		assert.Len(t, w, 1)
+		assert.Equal(t, imgSrc, w[0].Directive)
+	})
+
+	t.Run("Warns on sources ignored by strict-dynamic", func(t *testing.T) {
+		c := Default()
+		c.ScriptSrc = NewSourceList(SourceSelf, "cdn.example.com", "'nonce-abc123'")
+		c.StrictDynamic()
+
+		w := c.Lint()
+		assert.EqualValues(t, []Warning{{scriptSrc, "'strict-dynamic' causes 'self', cdn.example.com to be ignored", SeverityLow}}, w)
+	})
+
+	t.Run("Warns on strict-dynamic without nonce", func(t *testing.T) {
+		c := Default()
+		c.ScriptSrc = NewSourceList(SourceStrictDynamic)
+
+		w := c.Lint()
+		assert.EqualValues(t, []Warning{{scriptSrc, "'strict-dynamic' without a nonce or hash blocks all scripts", SeverityMedium}}, w)
+	})
+
+	t.Run("Strict policy nonce satisfies strict-dynamic", func(t *testing.T) {
+		// Strict omits default-src, which is warned about separately
+		missing := Warning{defaultSrc, "missing default-src leaves unset fetch directives unrestricted", SeverityMedium}
+		assert.EqualValues(t, []Warning{missing}, Strict().Lint())
+
+		c := Strict()
+		c.NonceDirectives = []string{styleSrc}
+		assert.Contains(t, c.Lint(), Warning{scriptSrc, "'strict-dynamic' without a nonce or hash blocks all scripts", SeverityMedium})
+
+		c = Default()
+		c.ScriptSrc = NewSourceList(NoncePlaceholder, SourceStrictDynamic)
+		assert.Empty(t, c.Lint())
+	})
+
+	t.Run("Warns on data: scripts", func(t *testing.T) {
+		c := Default()
+		c.ImgSrc = NewSourceList(SourceSelf, SchemeData)
+		c.ScriptSrc = NewSourceList(SourceSelf, SchemeData)
+
+		w := c.Lint()
+		assert.Len(t, w, 1)
+		assert.Equal(t, scriptSrc, w[0].Directive)
+	})
+
+	t.Run("Warns on http: alongside https:", func(t *testing.T) {
+		c := Default()
+		c.ConnectSrc = NewSourceList("https:", "http:")
+
+		w := c.Lint()
+		assert.Len(t, w, 1)
+		assert.Equal(t, connectSrc, w[0].Directive)
+		assert.Contains(t, w[0].Message, "redundant")
+	})
+
+	t.Run("Warns on missing default-src and object-src", func(t *testing.T) {
+		c := CSP{ScriptSrc: NewSourceList(SourceSelf)}
+
+		w := c.Lint()
+		assert.EqualValues(t, []Warning{
+			{defaultSrc, "missing default-src leaves unset fetch directives unrestricted", SeverityMedium},
+			{objectSrc, "object-src should be 'none' to prevent plugin based script injection", SeverityMedium},
+		}, w)
+
+		c.ObjectSrc = NewSourceList(SourceNone)
+		assert.Len(t, c.Lint(), 1)
+	})
+
+	t.Run("Warns on unsafe-inline without nonce", func(t *testing.T) {
+		c := Default()
+		c.ScriptSrc = NewSourceList(SourceSelf, SourceUnsafeInline)
+
+		w := c.Lint()
+		assert.EqualValues(t, []Warning{{scriptSrc, "'unsafe-inline' without a nonce or hash allows inline script injection", SeverityHigh}}, w)
+
+		c.ScriptSrc = append(c.ScriptSrc, "'nonce-abc123'")
+		assert.Empty(t, c.Lint())
+	})
+
+	t.Run("Warns on oversized policy", func(t *testing.T) {
+		c := Default()
+		for i := 0; i < 500; i++ {
+			c.ScriptSrc = append(c.ScriptSrc, fmt.Sprintf("https://cdn%d.example.com", i))
+		}
+		for i := 0; i < 10; i++ {
+			c.ImgSrc = append(c.ImgSrc, fmt.Sprintf("https://img%d.example.com", i))
+		}
+
+		w := c.Lint()
+		require.Len(t, w, 1)
+		assert.Equal(t, scriptSrc, w[0].Directive)
+		assert.Contains(t, w[0].Message, "exceeding 8192 bytes, largest directives: script-src 13407 bytes, img-src 264 bytes")
+
+		MaxPolicySize = 16 * 1024
+		defer func() { MaxPolicySize = 8 * 1024 }()
+		assert.Empty(t, c.Lint())
+	})
+
+	t.Run("Warns on report-sample outside script and style directives", func(t *testing.T) {
+		c := Default()
+		c.ImgSrc = NewSourceList(SourceSelf, SourceReportSample)
+		c.Extra = map[string]SourceList{
+			"script-src-elem": {SourceSelf, SourceReportSample},
+			"frame-ancestors": {SourceNone, SourceReportSample},
+		}
+		require.Nil(t, c.EnableReportSample(scriptSrc, styleSrc))
+
+		w := c.Lint()
+		assert.EqualValues(t, []Warning{
+			{imgSrc, "'report-sample' has no effect outside script and style directives", SeverityLow},
+			{"frame-ancestors", "'report-sample' has no effect outside script and style directives", SeverityLow},
+		}, w)
+	})
+
+	t.Run("Warns on unsafe-hashes", func(t *testing.T) {
+		c := Default()
+		c.ScriptSrc = NewSourceList(SourceSelf, SourceUnsafeHashes)
+		assert.EqualValues(t, []Warning{{scriptSrc, "'unsafe-hashes' has no effect without hash sources", SeverityLow}}, c.Lint())
+
+		c.ScriptSrc = NewSourceList(SourceSelf, SourceUnsafeHashes, "'nonce-abc123'")
+		assert.EqualValues(t, []Warning{{scriptSrc, "'unsafe-hashes' has no effect without hash sources", SeverityLow}}, c.Lint())
+
+		c.ScriptSrc = NewSourceList(SourceSelf, SourceUnsafeHashes, "'sha256-abc123'")
+		w := c.Lint()
+		require.Len(t, w, 1)
+		assert.Equal(t, SeverityMedium, w[0].Severity)
+	})
+
+	t.Run("Filter warnings by severity", func(t *testing.T) {
+		c := CSP{ScriptSrc: NewSourceList(SourceSelf, SourceUnsafeInline)}
+		assert.Len(t, c.LintSeverity(SeverityLow), 3)
+		assert.Len(t, c.LintSeverity(SeverityMedium), 3)
+
+		w := c.LintSeverity(SeverityHigh)
+		assert.Len(t, w, 1)
+		assert.Equal(t, "high", w[0].Severity.String())
+	})
+
+}
+
+func TestFrameworkWarnings(t *testing.T) {
+
+	t.Run("Strict policy warns for angular", func(t *testing.T) {
+		w := Default().FrameworkWarnings("Angular")
+		assert.Len(t, w, 1)
+		assert.Equal(t, styleSrc, w[0].Directive)
+	})
+
+	t.Run("Nonce satisfies inline styles", func(t *testing.T) {
+		c := Default()
+		c.StyleSrc = NewSourceList(SourceSelf, "'nonce-abc123'")
+		assert.Empty(t, c.FrameworkWarnings("angular"))
+	})
+
+	t.Run("Falls back to default-src", func(t *testing.T) {
+		c := CSP{DefaultSrc: NewSourceList(SourceSelf, SourceUnsafeEval)}
+		assert.Empty(t, c.FrameworkWarnings("vue"))
+	})
+
+	t.Run("Unknown framework", func(t *testing.T) {
+		assert.Empty(t, Default().FrameworkWarnings("unknown"))
+	})
+
+}
@@ -0,0 +1,54 @@
+package csp
+
+// fetchFallbacks lists the directives each fetch directive falls back to when unset, in order of precedence
+// https://www.w3.org/TR/CSP/#directive-fallback-list
+// The element and attribute directives are not fields of CSP and are held in Extra where set.
+var fetchFallbacks = map[string][]string{
+	childSrc:          {defaultSrc},
+	connectSrc:        {defaultSrc},
+	fontSrc:           {defaultSrc},
+	frameSrc:          {childSrc, defaultSrc},
+	imgSrc:            {defaultSrc},
+	manifestSrc:       {defaultSrc},
+	mediaSrc:          {defaultSrc},
+	objectSrc:         {defaultSrc},
+	prefetchSrc:       {defaultSrc},
+	scriptSrc:         {defaultSrc},
+	"script-src-elem": {scriptSrc, defaultSrc},
+	"script-src-attr": {scriptSrc, defaultSrc},
+	styleSrc:          {defaultSrc},
+	"style-src-elem":  {styleSrc, defaultSrc},
+	"style-src-attr":  {styleSrc, defaultSrc},
+	workerSrc:         {childSrc, scriptSrc, defaultSrc},
+}
+
+// Materialize sets each unset fetch directive to the sources it would otherwise inherit (usually from default-src),
+// so the marshaled policy spells out every directive explicitly for review. The effective policy is unchanged.
+func (c *CSP) Materialize() {
+	orig := c.clone()
+
+	for _, d := range c.directives() {
+		fallbacks, ok := fetchFallbacks[d.name]
+		if !ok || len(*d.sources) != 0 {
+			continue
+		}
+		for _, f := range fallbacks {
+			if s := *orig.sourceList(f); len(s) != 0 {
+				*d.sources = append(SourceList{}, s...)
+				break
+			}
+		}
+	}
+}
+
+// Effective resolves the sources a browser enforces for a directive, following the fallback list where it is unset
+// (eg. script-src-elem falls back to script-src then default-src). Directives without fallbacks return their own
+// sources, and nil is returned where neither the directive nor its fallbacks are set.
+func (c CSP) Effective(directive string) SourceList {
+	for _, d := range append([]string{directive}, fetchFallbacks[directive]...) {
+		if s := c.lookup(d); len(s) != 0 {
+			return append(SourceList{}, s...)
+		}
+	}
+	return nil
+}
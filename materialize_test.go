@@ -0,0 +1,70 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterialize(t *testing.T) {
+
+	t.Run("Fetch directives inherit default-src", func(t *testing.T) {
+		c := Default()
+		c.BaseURI = NewSourceList(SourceSelf)
+		c.Materialize()
+
+		txt, err := c.MarshalText()
+		require.Nil(t, err)
+		assert.Equal(t, "default-src 'none'; child-src 'none'; connect-src 'self'; font-src 'none'; frame-src 'none'; img-src 'self'; "+
+			"manifest-src 'none'; media-src 'none'; object-src 'none'; prefetch-src 'none'; script-src 'self'; style-src 'self'; "+
+			"worker-src 'self'; base-uri 'self'", string(txt))
+	})
+
+	t.Run("Frame and worker sources inherit child-src", func(t *testing.T) {
+		c := CSP{DefaultSrc: NewSourceList(SourceSelf), ChildSrc: NewSourceList("child.example.com")}
+		c.Materialize()
+
+		assert.EqualValues(t, NewSourceList("child.example.com"), c.FrameSrc)
+		assert.EqualValues(t, NewSourceList("child.example.com"), c.WorkerSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf), c.ImgSrc)
+	})
+
+	t.Run("No default-src leaves directives unset", func(t *testing.T) {
+		c := CSP{ScriptSrc: NewSourceList(SourceSelf)}
+		c.Materialize()
+
+		assert.EqualValues(t, CSP{ScriptSrc: NewSourceList(SourceSelf), WorkerSrc: NewSourceList(SourceSelf)}, c)
+	})
+}
+
+func TestEffective(t *testing.T) {
+	c := CSP{
+		DefaultSrc: NewSourceList(SourceSelf),
+		ScriptSrc:  NewSourceList("scripts.example.com"),
+		Extra: map[string]SourceList{
+			"script-src-attr": {SourceNone},
+			"style-src-elem":  {"styles.example.com"},
+		},
+	}
+
+	t.Run("Script directives", func(t *testing.T) {
+		assert.EqualValues(t, NewSourceList("scripts.example.com"), c.Effective("script-src-elem"))
+		assert.EqualValues(t, NewSourceList(SourceNone), c.Effective("script-src-attr"))
+		assert.EqualValues(t, NewSourceList("scripts.example.com"), c.Effective(workerSrc))
+
+		d := CSP{DefaultSrc: NewSourceList(SourceSelf)}
+		assert.EqualValues(t, NewSourceList(SourceSelf), d.Effective("script-src-elem"))
+	})
+
+	t.Run("Style directives", func(t *testing.T) {
+		assert.EqualValues(t, NewSourceList("styles.example.com"), c.Effective("style-src-elem"))
+		assert.EqualValues(t, NewSourceList(SourceSelf), c.Effective("style-src-attr"))
+		assert.EqualValues(t, NewSourceList(SourceSelf), c.Effective(styleSrc))
+	})
+
+	t.Run("Directives without fallbacks", func(t *testing.T) {
+		assert.Nil(t, c.Effective(baseURI))
+		assert.Nil(t, CSP{}.Effective(scriptSrc))
+	})
+}
@@ -0,0 +1,126 @@
+package csp
+
+// Merge combines two policies, returning a new policy and leaving both inputs unmodified
+// Sources are unioned per directive (dropping 'none' where the other policy allows sources),
+// and settings such as report-to are taken from the other policy where set, along with its reporting groups.
+func (c CSP) Merge(other CSP) CSP {
+	m := c
+
+	otherDirectives := other.directives()
+	for i, d := range m.directives() {
+		*d.sources = d.sources.union(*otherDirectives[i].sources)
+	}
+
+	if c.Extra != nil || other.Extra != nil {
+		m.Extra = make(map[string]SourceList)
+		for k, v := range c.Extra {
+			m.Extra[k] = v.union(other.Extra[k])
+		}
+		for k, v := range other.Extra {
+			if _, ok := m.Extra[k]; !ok {
+				m.Extra[k] = v.union(nil)
+			}
+		}
+	}
+
+	m.ReportOnly = c.ReportOnly || other.ReportOnly
+	if other.WebRTC != "" {
+		m.WebRTC = other.WebRTC
+	}
+	if other.ReportURI != "" {
+		m.ReportURI = other.ReportURI
+	}
+	if other.ReportTo != "" {
+		m.ReportTo = other.ReportTo
+	}
+	m.ReportingGroups = mergeGroups(other.ReportingGroups, c.ReportingGroups)
+
+	return m
+}
+
+// WithDefaults returns a copy of the policy with unset directives and settings taken from defaults
+// Unlike Merge, directives set in the policy are kept as-is rather than unioned with the defaults,
+// allowing a partial (eg. per route) policy to override a site wide default. Flags such as ReportOnly are not inherited.
+func (c CSP) WithDefaults(defaults CSP) CSP {
+	m := c.clone()
+	d := defaults.clone()
+
+	defaultDirectives := d.directives()
+	for i, v := range m.directives() {
+		set := len(*v.sources) != 0 || (valueless[v.name] && *v.sources != nil)
+		if !set {
+			*v.sources = *defaultDirectives[i].sources
+		}
+	}
+
+	for k, v := range d.Extra {
+		if _, ok := m.Extra[k]; ok {
+			continue
+		}
+		if m.Extra == nil {
+			m.Extra = make(map[string]SourceList)
+		}
+		m.Extra[k] = v
+	}
+
+	if m.WebRTC == "" {
+		m.WebRTC = d.WebRTC
+	}
+	if m.ReportURI == "" {
+		m.ReportURI = d.ReportURI
+	}
+	if m.ReportTo == "" {
+		m.ReportTo = d.ReportTo
+	}
+	m.ReportingGroups = mergeGroups(m.ReportingGroups, d.ReportingGroups)
+
+	return m
+}
+
+// AppendTo merges the policy into an existing header value, returning the combined header value
+// This allows middleware layers to contribute directives to a policy without owning the whole header.
+func (c CSP) AppendTo(existing string) (string, error) {
+	e := CSP{}
+	err := e.UnmarshalText([]byte(existing))
+	if err != nil {
+		return "", err
+	}
+
+	m := e.Merge(c)
+
+	txt, err := m.MarshalText()
+	if err != nil {
+		return "", err
+	}
+
+	return string(txt), nil
+}
+
+// union returns a new source list containing the sources from both lists
+func (s SourceList) union(other SourceList) SourceList {
+	if s == nil && other == nil {
+		return nil
+	}
+
+	u := make(SourceList, 0, len(s)+len(other))
+	for _, l := range []SourceList{s, other} {
+		for _, v := range l {
+			if !u.Contains(v) {
+				u = append(u, v)
+			}
+		}
+	}
+
+	// 'none' is only valid as the sole source of a directive
+	if len(u) > 1 && u.Contains(SourceNone) {
+		n := make(SourceList, 0, len(u)-1)
+		for _, v := range u {
+			if v != SourceNone {
+				n = append(n, v)
+			}
+		}
+		u = n
+	}
+
+	return u
+}
@@ -0,0 +1,86 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+
+	t.Run("Merge unions directives", func(t *testing.T) {
+		a := CSP{
+			DefaultSrc: NewSourceList(SourceNone),
+			ScriptSrc:  NewSourceList(SourceSelf),
+		}
+		b := CSP{
+			DefaultSrc: NewSourceList(SourceSelf),
+			ScriptSrc:  NewSourceList(SourceSelf, "cdn.example.com"),
+			ReportTo:   "csp-endpoint",
+		}
+
+		m := a.Merge(b)
+		assert.EqualValues(t, NewSourceList(SourceSelf), m.DefaultSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf, "cdn.example.com"), m.ScriptSrc)
+		assert.EqualValues(t, "csp-endpoint", m.ReportTo)
+
+		// Inputs are unchanged
+		assert.EqualValues(t, NewSourceList(SourceNone), a.DefaultSrc)
+		assert.EqualValues(t, NewSourceList(SourceSelf), a.ScriptSrc)
+	})
+
+	t.Run("Append to existing policy", func(t *testing.T) {
+		c := CSP{
+			ImgSrc:    NewSourceList(SourceSelf),
+			ScriptSrc: NewSourceList("cdn.example.com"),
+		}
+
+		h, err := c.AppendTo("default-src 'none'; script-src 'self'")
+		require.Nil(t, err)
+		assert.EqualValues(t, "default-src 'none'; img-src 'self'; script-src 'self' cdn.example.com", h)
+	})
+
+	t.Run("With defaults fills unset directives", func(t *testing.T) {
+		route := CSP{
+			ScriptSrc:    NewSourceList("cdn.example.com"),
+			TrustedTypes: []string{},
+			ReportOnly:   true,
+		}
+		site := Default()
+		site.TrustedTypes = []string{"default"}
+		site.ReportTo = "csp-endpoint"
+
+		c := route.WithDefaults(site)
+		txt, err := c.MarshalText()
+		require.Nil(t, err)
+		assert.EqualValues(t, "default-src 'none'; connect-src 'self'; img-src 'self'; script-src cdn.example.com; style-src 'self'; trusted-types; report-to csp-endpoint", string(txt))
+		assert.True(t, c.ReportOnly)
+
+		// Inputs are not shared with the result
+		c.ImgSrc[0] = "img.example.com"
+		assert.EqualValues(t, NewSourceList(SourceSelf), site.ImgSrc)
+		assert.Nil(t, route.ImgSrc)
+	})
+	t.Run("Reporting groups are merged and inherited", func(t *testing.T) {
+		a, b := Default(), Default()
+		a.AddReportingGroup(ReportingGroup{"a", "https://a.example.com/reports", 60})
+		b.AddReportingGroup(ReportingGroup{"g", "https://example.com/reports", 3600})
+
+		m := Default().Merge(b)
+		assert.Equal(t, "g", m.ReportTo)
+		assert.EqualValues(t, b.ReportingGroups, m.ReportingGroups)
+
+		m = a.Merge(b)
+		assert.Equal(t, "g", m.ReportTo)
+		assert.EqualValues(t, []ReportingGroup{b.ReportingGroups[0], a.ReportingGroups[0]}, m.ReportingGroups)
+
+		c := CSP{ScriptSrc: NewSourceList(SourceSelf)}.WithDefaults(b)
+		assert.Equal(t, "g", c.ReportTo)
+		assert.EqualValues(t, b.ReportingGroups, c.ReportingGroups)
+
+		c = a.WithDefaults(b)
+		assert.Equal(t, "a", c.ReportTo)
+		assert.EqualValues(t, []ReportingGroup{a.ReportingGroups[0], b.ReportingGroups[0]}, c.ReportingGroups)
+	})
+}
@@ -0,0 +1,85 @@
+package csp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// metaExcluded are directives not supported when delivering a policy with a <meta> tag
+// https://www.w3.org/TR/CSP/#meta-element
+var metaExcluded = map[string]bool{
+	"frame-ancestors": true,
+	reportURI:         true,
+	"sandbox":         true,
+}
+
+// metaEscaper escapes policy text for use in a double quoted attribute
+var metaEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;", "<", "&lt;", ">", "&gt;")
+
+// PolicyTarget selects how a policy is delivered, see For
+type PolicyTarget int
+
+const (
+	TargetHeader PolicyTarget = iota // TargetHeader serializes the policy as a header value
+	TargetMeta                       // TargetMeta serializes the policy as a <meta http-equiv> tag
+)
+
+// metaEntries splits the policy entries into those supported in meta tags and the names of those omitted
+func (c *CSP) metaEntries() ([]entry, []string) {
+	entries := make([]entry, 0)
+	omitted := make([]string, 0)
+	for _, e := range c.entries() {
+		if metaExcluded[e.name] {
+			omitted = append(omitted, e.name)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, omitted
+}
+
+// metaTag formats policy entries as a <meta http-equiv> tag
+func metaTag(entries []entry) string {
+	return fmt.Sprintf(`<meta http-equiv="%s" content="%s">`, HeaderPolicy, metaEscaper.Replace(string(joinEntries(entries))))
+}
+
+// MetaTag formats the policy as a <meta http-equiv> tag, for static sites delivering policies in HTML
+// Directives unsupported in meta tags (frame-ancestors, report-uri and sandbox) are omitted, in which case
+// the tag is returned along with an error listing the omitted directives.
+// Report only policies cannot be delivered by meta tags and return an error.
+func (c CSP) MetaTag() (string, error) {
+	if c.ReportOnly {
+		return "", fmt.Errorf("Report only policies are not supported in meta tags")
+	}
+
+	entries, omitted := c.metaEntries()
+	tag := metaTag(entries)
+
+	if len(omitted) != 0 {
+		return tag, fmt.Errorf("Directives %s are not supported in meta tags and were omitted", strings.Join(omitted, ", "))
+	}
+	return tag, nil
+}
+
+// For serializes the policy for the target, either a header value or a <meta http-equiv> tag, along with
+// warnings for directives unsupported by the target that were omitted.
+// Report only policies cannot be delivered by meta tags, returning an empty string and a warning.
+func (c CSP) For(target PolicyTarget) (string, []Warning) {
+	warnings := make([]Warning, 0)
+
+	switch target {
+	case TargetHeader:
+		return string(joinEntries(c.entries())), warnings
+	case TargetMeta:
+		if c.ReportOnly {
+			return "", append(warnings, Warning{"", "Report only policies are not supported in meta tags", SeverityHigh})
+		}
+		entries, omitted := c.metaEntries()
+		for _, name := range omitted {
+			warnings = append(warnings, Warning{name, "not supported in meta tags and omitted", SeverityMedium})
+		}
+		return metaTag(entries), warnings
+	default:
+		return "", append(warnings, Warning{"", fmt.Sprintf("Unknown policy target %d", target), SeverityHigh})
+	}
+}
@@ -0,0 +1,66 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaTag(t *testing.T) {
+
+	t.Run("Default policy", func(t *testing.T) {
+		tag, err := Default().MetaTag()
+		require.Nil(t, err)
+		assert.Equal(t, `<meta http-equiv="Content-Security-Policy" content="`+DefaultPolicy+`">`, tag)
+	})
+
+	t.Run("Unsupported directives are omitted", func(t *testing.T) {
+		c := Default()
+		c.WithReporting("/_/csp-reports", "csp-endpoint")
+		c.Extra = map[string]SourceList{
+			"frame-ancestors": {SourceNone},
+			"sandbox":         {"allow-scripts"},
+		}
+
+		tag, err := c.MetaTag()
+		assert.EqualError(t, err, "Directives report-uri, frame-ancestors, sandbox are not supported in meta tags and were omitted")
+		assert.Equal(t, `<meta http-equiv="Content-Security-Policy" content="`+DefaultPolicy+`; report-to csp-endpoint">`, tag)
+	})
+
+	t.Run("Report only policies are unsupported", func(t *testing.T) {
+		c := Default()
+		c.ReportOnly = true
+
+		_, err := c.MetaTag()
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFor(t *testing.T) {
+	c := Default()
+	c.WithReporting("/_/csp-reports", "csp-endpoint")
+	c.Extra = map[string]SourceList{"frame-ancestors": {SourceNone}}
+
+	t.Run("Header target", func(t *testing.T) {
+		v, w := c.For(TargetHeader)
+		assert.Empty(t, w)
+		assert.Equal(t, DefaultPolicy+"; report-uri /_/csp-reports; report-to csp-endpoint; frame-ancestors 'none'", v)
+	})
+
+	t.Run("Meta target", func(t *testing.T) {
+		v, w := c.For(TargetMeta)
+		assert.EqualValues(t, []Warning{
+			{reportURI, "not supported in meta tags and omitted", SeverityMedium},
+			{"frame-ancestors", "not supported in meta tags and omitted", SeverityMedium},
+		}, w)
+		assert.Equal(t, `<meta http-equiv="Content-Security-Policy" content="`+DefaultPolicy+`; report-to csp-endpoint">`, v)
+	})
+
+	t.Run("Meta target rejects report only policies", func(t *testing.T) {
+		v, w := c.AsReportOnly().For(TargetMeta)
+		assert.Empty(t, v)
+		require.Len(t, w, 1)
+		assert.Equal(t, SeverityHigh, w[0].Severity)
+	})
+}
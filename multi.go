@@ -0,0 +1,24 @@
+package csp
+
+import "errors"
+
+// multiReporter passes each report to a list of ReportHandlers
+type multiReporter []ReportHandler
+
+// MultiReporter creates a ReportHandler that passes each report to all handlers in order
+// (eg. to log, count and forward reports). Every handler is called regardless of earlier failures,
+// with any errors joined.
+func MultiReporter(handlers ...ReportHandler) ReportHandler {
+	return multiReporter(handlers)
+}
+
+// Report passes a CSP report to each handler, returning the joined errors
+func (m multiReporter) Report(r Report) error {
+	errs := make([]error, 0)
+	for _, h := range m {
+		if err := h.Report(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,45 @@
+package csp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type funcReporter func(r Report) error
+
+func (f funcReporter) Report(r Report) error {
+	return f(r)
+}
+
+func TestMultiReporter(t *testing.T) {
+	rep := Report{ViolatedDirective: "script-src 'self'", BlockedURI: "inline"}
+
+	t.Run("Passes reports to all handlers", func(t *testing.T) {
+		a, b := NewAggregatingReporter(), NewAggregatingReporter()
+
+		err := MultiReporter(a, b).Report(rep)
+		require.Nil(t, err)
+
+		expected := map[AggregateKey]int{{rep.ViolatedDirective, rep.BlockedURI}: 1}
+		assert.EqualValues(t, expected, a.Snapshot())
+		assert.EqualValues(t, expected, b.Snapshot())
+	})
+
+	t.Run("Joins handler errors", func(t *testing.T) {
+		errA, errB := errors.New("a failed"), errors.New("b failed")
+		a := NewAggregatingReporter()
+
+		fail := func(e error) ReportHandler {
+			return funcReporter(func(r Report) error { return e })
+		}
+
+		err := MultiReporter(fail(errA), a, fail(errB)).Report(rep)
+		require.NotNil(t, err)
+		assert.True(t, errors.Is(err, errA))
+		assert.True(t, errors.Is(err, errB))
+		assert.Len(t, a.Snapshot(), 1)
+	})
+}
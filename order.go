@@ -0,0 +1,62 @@
+package csp
+
+import (
+	"sort"
+)
+
+// DirectiveOrder lists directive names in the order they are to be marshaled
+// Directives not listed are marshaled after those listed, in canonical order.
+type DirectiveOrder []string
+
+// CanonicalOrder orders directives with default-src first, followed by the remaining directives alphabetically
+var CanonicalOrder = DirectiveOrder{defaultSrc}
+
+// InputOrder returns the order of directives in a policy text, for preserving the input order when re-marshaling
+func InputOrder(text []byte) DirectiveOrder {
+	order := make(DirectiveOrder, 0)
+	for _, e := range splitDirectives(text) {
+		order = append(order, e.name)
+	}
+
+	return order
+}
+
+// MarshalTextOrdered marshals a CSP policy to text with directives in the provided order
+func (c *CSP) MarshalTextOrdered(order DirectiveOrder) ([]byte, error) {
+	index := make(map[string]int, len(order))
+	for i, v := range order {
+		index[v] = i
+	}
+
+	entries := c.entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, aok := index[entries[i].name]
+		b, bok := index[entries[j].name]
+		switch {
+		case aok && bok:
+			return a < b
+		case aok || bok:
+			return aok
+		case entries[i].name == defaultSrc || entries[j].name == defaultSrc:
+			return entries[i].name == defaultSrc
+		default:
+			return entries[i].name < entries[j].name
+		}
+	})
+
+	return joinEntries(entries), nil
+}
+
+// MarshalTextSorted marshals a CSP policy to text with directives sorted alphabetically, for stable and readable output
+// Where pinDefault is set default-src is placed first, equivalent to MarshalTextOrdered(CanonicalOrder).
+func (c *CSP) MarshalTextSorted(pinDefault bool) ([]byte, error) {
+	entries := c.entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		if pinDefault && (entries[i].name == defaultSrc || entries[j].name == defaultSrc) {
+			return entries[i].name == defaultSrc
+		}
+		return entries[i].name < entries[j].name
+	})
+
+	return joinEntries(entries), nil
+}
@@ -0,0 +1,47 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalTextOrdered(t *testing.T) {
+	const input = "script-src 'self'; report-to csp-endpoint; img-src 'self'; default-src 'none'; connect-src 'self'"
+
+	c := CSP{}
+	require.Nil(t, c.UnmarshalText([]byte(input)))
+
+	t.Run("Canonical order", func(t *testing.T) {
+		txt, err := c.MarshalTextOrdered(CanonicalOrder)
+		require.Nil(t, err)
+		assert.EqualValues(t, "default-src 'none'; connect-src 'self'; img-src 'self'; report-to csp-endpoint; script-src 'self'", string(txt))
+	})
+
+	t.Run("Input order", func(t *testing.T) {
+		txt, err := c.MarshalTextOrdered(InputOrder([]byte(input)))
+		require.Nil(t, err)
+		assert.EqualValues(t, input, string(txt))
+	})
+
+	t.Run("Partial order", func(t *testing.T) {
+		txt, err := c.MarshalTextOrdered(DirectiveOrder{scriptSrc})
+		require.Nil(t, err)
+		assert.EqualValues(t, "script-src 'self'; default-src 'none'; connect-src 'self'; img-src 'self'; report-to csp-endpoint", string(txt))
+	})
+
+	t.Run("Sorted order", func(t *testing.T) {
+		txt, err := c.MarshalText()
+		require.Nil(t, err)
+		assert.EqualValues(t, "default-src 'none'; connect-src 'self'; img-src 'self'; script-src 'self'; report-to csp-endpoint", string(txt))
+
+		txt, err = c.MarshalTextSorted(false)
+		require.Nil(t, err)
+		assert.EqualValues(t, "connect-src 'self'; default-src 'none'; img-src 'self'; report-to csp-endpoint; script-src 'self'", string(txt))
+
+		txt, err = c.MarshalTextSorted(true)
+		require.Nil(t, err)
+		assert.EqualValues(t, "default-src 'none'; connect-src 'self'; img-src 'self'; report-to csp-endpoint; script-src 'self'", string(txt))
+	})
+}
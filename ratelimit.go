@@ -0,0 +1,90 @@
+package csp
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the default number of entries tracked for report deduplication and rate limiting
+const DefaultCacheSize = 1024
+
+// Deduplicate is a RouteHandler option that suppresses identical reports received within a window
+// By default reports are identical where the violated-directive and blocked-uri match, Key overrides this.
+type Deduplicate struct {
+	Window time.Duration         // Window in which duplicate reports are suppressed
+	Size   int                   // Size is the maximum number of reports tracked, defaults to DefaultCacheSize
+	Key    func(r Report) string // Key optionally computes the key used to identify duplicate reports
+}
+
+// RateLimit is a RouteHandler option that limits the number of reports accepted from each client address
+// Client addresses are resolved using any TrustedProxies passed to the RouteHandler, requests without a parseable
+// client address (eg. over unix sockets) are not limited rather than sharing a single limit.
+type RateLimit struct {
+	Limit  int           // Limit is the number of reports accepted from a client per window, zero or less is unlimited
+	Window time.Duration // Window over which reports are counted
+	Size   int           // Size is the maximum number of clients tracked, defaults to DefaultCacheSize
+}
+
+// timeNow is overridden in tests
+var timeNow = time.Now
+
+// windowCache is an LRU cache counting hits per key within a fixed window
+type windowCache struct {
+	mu     sync.Mutex
+	size   int
+	window time.Duration
+	ll     *list.List
+	items  map[string]*list.Element
+}
+
+type windowEntry struct {
+	key   string
+	start time.Time
+	count int
+}
+
+func newWindowCache(size int, window time.Duration) *windowCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &windowCache{
+		size:   size,
+		window: window,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+	}
+}
+
+// hit records a hit for a key, returning the number of hits within the current window
+func (w *windowCache) hit(key string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := timeNow()
+
+	if e, ok := w.items[key]; ok {
+		w.ll.MoveToFront(e)
+		entry := e.Value.(*windowEntry)
+		if now.Sub(entry.start) >= w.window {
+			entry.start, entry.count = now, 0
+		}
+		entry.count++
+		return entry.count
+	}
+
+	w.items[key] = w.ll.PushFront(&windowEntry{key, now, 1})
+	if w.ll.Len() > w.size {
+		e := w.ll.Back()
+		w.ll.Remove(e)
+		delete(w.items, e.Value.(*windowEntry).key)
+	}
+
+	return 1
+}
+
+// dedupKey builds the default deduplication key for a report
+func dedupKey(r Report) string {
+	return strings.Join([]string{r.ViolatedDirective, r.BlockedURI}, "\x00")
+}
@@ -0,0 +1,139 @@
+package csp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IsRegression compares two policies and reports whether the next policy is less secure than the previous,
+// along with the reasons for this.
+// Only security regressions are reported (unsafe sources, broadened wildcards, removal of default-src, non-fetch directives
+// including those in Extra such as frame-ancestors, or reporting),
+// other changes such as adding a specific host are not considered regressions.
+func IsRegression(prev, next CSP) (bool, []string) {
+	reasons := make([]string, 0)
+
+	if !prev.ReportOnly && next.ReportOnly {
+		reasons = append(reasons, "policy changed to report only")
+	}
+	if len(prev.DefaultSrc) != 0 && len(next.DefaultSrc) == 0 {
+		reasons = append(reasons, fmt.Sprintf("%s removed", defaultSrc))
+	}
+	if prev.WebRTC == WebRTCBlock && next.WebRTC != WebRTCBlock {
+		reasons = append(reasons, fmt.Sprintf("%s no longer blocked", webRTC))
+	}
+	if prev.ReportURI != "" && next.ReportURI == "" {
+		reasons = append(reasons, fmt.Sprintf("%s removed", reportURI))
+	}
+	if prev.ReportTo != "" && next.ReportTo == "" {
+		reasons = append(reasons, fmt.Sprintf("%s removed", reportTo))
+	}
+
+	prevDirectives := prev.directives()
+	for i, d := range next.directives() {
+		p, n := *prevDirectives[i].sources, *d.sources
+
+		// Other directives do not fall back, so removing them drops the restriction entirely
+		_, fetch := fetchFallbacks[d.name]
+		if !fetch && d.name != defaultSrc {
+			set := func(l SourceList) bool { return len(l) != 0 || (l != nil && valueless[d.name]) }
+			if set(p) && !set(n) {
+				reasons = append(reasons, fmt.Sprintf("%s removed", d.name))
+			}
+		}
+
+		// Removed fetch directives fall back to default-src, which may be broader
+		if fetch && len(p) != 0 && len(n) == 0 {
+			if len(next.DefaultSrc) == 0 {
+				reasons = append(reasons, fmt.Sprintf("%s removed with no %s fallback", d.name, defaultSrc))
+			}
+			for _, s := range next.DefaultSrc {
+				if s != SourceNone && !p.Contains(s) {
+					reasons = append(reasons, fmt.Sprintf("%s removed, falling back to broader %s", d.name, defaultSrc))
+					break
+				}
+			}
+		}
+
+		for _, s := range n {
+			if p.Contains(s) {
+				continue
+			}
+			if isUnsafeSource(s) {
+				reasons = append(reasons, fmt.Sprintf("%s adds unsafe source %s", d.name, s))
+			} else if isWildcardSource(s) {
+				reasons = append(reasons, fmt.Sprintf("%s adds wildcard source %s", d.name, s))
+			}
+		}
+	}
+
+	reasons = append(reasons, extraRegressions(prev, next)...)
+
+	return len(reasons) != 0, reasons
+}
+
+// extraRegressions compares the directives in Extra (eg. frame-ancestors, sandbox), in name order
+func extraRegressions(prev, next CSP) []string {
+	reasons := make([]string, 0)
+
+	names := make([]string, 0, len(prev.Extra)+len(next.Extra))
+	for k := range prev.Extra {
+		names = append(names, k)
+	}
+	for k := range next.Extra {
+		if _, ok := prev.Extra[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, wasSet := prev.Extra[name]
+		n, set := next.Extra[name]
+
+		if wasSet && !set {
+			// Removed fetch directives fall back, which is only a regression where the fallback is broader
+			if _, fetch := fetchFallbacks[name]; !fetch {
+				reasons = append(reasons, fmt.Sprintf("%s removed", name))
+				continue
+			}
+			for _, s := range next.Effective(name) {
+				if s != SourceNone && !p.Contains(s) {
+					reasons = append(reasons, fmt.Sprintf("%s removed, falling back to broader sources", name))
+					break
+				}
+			}
+			continue
+		}
+
+		for _, s := range n {
+			if p.Contains(s) {
+				continue
+			}
+			if name == "sandbox" && wasSet {
+				// Each sandbox token lifts a restriction
+				reasons = append(reasons, fmt.Sprintf("%s adds %s", name, s))
+			} else if isUnsafeSource(s) {
+				reasons = append(reasons, fmt.Sprintf("%s adds unsafe source %s", name, s))
+			} else if isWildcardSource(s) {
+				reasons = append(reasons, fmt.Sprintf("%s adds wildcard source %s", name, s))
+			}
+		}
+	}
+
+	return reasons
+}
+
+// isUnsafeSource checks whether a source is one of the 'unsafe-*' keywords
+func isUnsafeSource(source string) bool {
+	return strings.HasPrefix(source, "'") && strings.Contains(source, "unsafe-")
+}
+
+// isWildcardSource checks whether a source matches broadly, either through a wildcard or a bare scheme
+func isWildcardSource(source string) bool {
+	if strings.Contains(source, "*") {
+		return true
+	}
+	return strings.HasSuffix(source, ":") && !strings.Contains(source, "/")
+}
@@ -0,0 +1,87 @@
+package csp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRegression(t *testing.T) {
+
+	t.Run("Adding unsafe-inline is a regression", func(t *testing.T) {
+		next := Default()
+		next.ScriptSrc = NewSourceList(SourceSelf, SourceUnsafeInline)
+
+		regression, reasons := IsRegression(Default(), next)
+		assert.True(t, regression)
+		assert.EqualValues(t, []string{"script-src adds unsafe source 'unsafe-inline'"}, reasons)
+	})
+
+	t.Run("Adding wildcards is a regression", func(t *testing.T) {
+		next := Default()
+		next.ImgSrc = NewSourceList(SourceSelf, "https:", "*.example.com")
+
+		regression, reasons := IsRegression(Default(), next)
+		assert.True(t, regression)
+		assert.Len(t, reasons, 2)
+	})
+
+	t.Run("Removing default-src and reporting is a regression", func(t *testing.T) {
+		prev := Default()
+		prev.ReportTo = "csp-endpoint"
+		next := Default()
+		next.DefaultSrc = nil
+
+		regression, reasons := IsRegression(prev, next)
+		assert.True(t, regression)
+		assert.EqualValues(t, []string{"default-src removed", "report-to removed"}, reasons)
+	})
+
+	t.Run("Removing non fetch directives is a regression", func(t *testing.T) {
+		prev := CSP{
+			DefaultSrc:             NewSourceList(SourceNone),
+			BaseURI:                NewSourceList(SourceNone),
+			RequireTrustedTypesFor: []string{"'script'"},
+			TrustedTypes:           []string{},
+		}
+		next := CSP{DefaultSrc: NewSourceList(SourceNone)}
+
+		regression, reasons := IsRegression(prev, next)
+		assert.True(t, regression)
+		assert.EqualValues(t, []string{"base-uri removed", "require-trusted-types-for removed", "trusted-types removed"}, reasons)
+
+		regression, _ = IsRegression(prev, prev)
+		assert.False(t, regression)
+	})
+
+	t.Run("Tightening is not a regression", func(t *testing.T) {
+		prev := Default()
+		prev.ScriptSrc = NewSourceList(SourceSelf, SourceUnsafeInline, "cdn.example.com")
+		next := Default()
+		next.ImgSrc = nil
+
+		regression, reasons := IsRegression(prev, next)
+		assert.False(t, regression)
+		assert.Empty(t, reasons)
+	})
+
+	t.Run("Changes to extra directives are regressions", func(t *testing.T) {
+		prev, err := Parse("default-src 'self'; frame-ancestors 'none'; sandbox allow-forms; upgrade-insecure-requests")
+		require.Nil(t, err)
+		next, err := Parse("default-src 'self'; sandbox allow-forms allow-scripts; form-action *")
+		require.Nil(t, err)
+
+		regression, reasons := IsRegression(prev, next)
+		assert.True(t, regression)
+		assert.EqualValues(t, []string{
+			"form-action adds wildcard source *",
+			"frame-ancestors removed",
+			"sandbox adds allow-scripts",
+			"upgrade-insecure-requests removed",
+		}, reasons)
+
+		regression, _ = IsRegression(next, next)
+		assert.False(t, regression)
+	})
+}
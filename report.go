@@ -1,11 +1,18 @@
 package csp
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
 )
 
 // CSP header keys
@@ -13,31 +20,211 @@ const (
 	HeaderPolicy     = "Content-Security-Policy"
 	HeaderReport     = "Content-Security-Policy-Report"
 	HeaderReportOnly = "Content-Security-Policy-Report-Only"
+	HeaderReportTo   = "Report-To"
 
-	ReportContentType = "application/csp-report"
+	ReportContentType  = "application/csp-report"
+	ReportsContentType = "application/reports+json" // ReportsContentType is the Reporting API format used with report-to
 )
 
+// DefaultMaxBodySize is the default limit on report body sizes accepted by RouteHandler
+const DefaultMaxBodySize = 64 * 1024
+
+// MaxBodySize is a RouteHandler option setting the maximum accepted report body size in bytes
+type MaxBodySize int64
+
+// DebugBodySize is a RouteHandler option including up to this many bytes of unparseable report bodies
+// in the error passed to the ErrorHandler (as a *BodyError), for diagnosing malformed reports.
+// This is intended for debugging only as report bodies may contain sensitive information.
+type DebugBodySize int
+
+// BodyError is an error parsing a report body, including the start of the rejected body
+type BodyError struct {
+	Err  error
+	Body []byte
+}
+
+// Error formats the parse error along with the rejected body
+func (e *BodyError) Error() string {
+	return fmt.Sprintf("%v (body %q)", e.Err, e.Body)
+}
+
+// Unwrap returns the underlying parse error
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// Disposition describes whether a violated policy was enforced or report only
+type Disposition string
+
+// Report dispositions
+const (
+	DispositionEnforce Disposition = "enforce"
+	DispositionReport  Disposition = "report"
+)
+
+// Valid checks whether a disposition is one of the values defined by the specification
+func (d Disposition) Valid() bool {
+	return d == DispositionEnforce || d == DispositionReport
+}
+
 // Report CSP report structure
 type Report struct {
-	DocumentURI        string `json:"document-uri"`
-	Referrer           string `json:"referrer"`
-	BlockedURI         string `json:"blocked-uri"`
-	EffectiveDirective string `json:"effective-directive"`
-	ViolatedDirective  string `json:"violated-directive"`
-	OriginalPolicy     string `json:"original-policy"`
-	Disposition        string `json:"disposition"`
-	StatusCode         int    `json:"status"`
+	DocumentURI        string      `json:"document-uri"`
+	Referrer           string      `json:"referrer"`
+	BlockedURI         string      `json:"blocked-uri"`
+	EffectiveDirective string      `json:"effective-directive"`
+	ViolatedDirective  string      `json:"violated-directive"`
+	OriginalPolicy     string      `json:"original-policy"`
+	Disposition        Disposition `json:"disposition"`
+	StatusCode         int         `json:"status"`
+	Sample             string      `json:"script-sample"` // Sample is the start of the violating code, where 'report-sample' is set
+	SourceFile         string      `json:"source-file"`
+	LineNumber         int         `json:"line-number"`
+	ColumnNumber       int         `json:"column-number"`
 }
 
 type cspReport struct {
 	Report `json:"csp-report"`
 }
 
+// reportingAPIReport is a CSP violation report in the Reporting API format
+// https://w3c.github.io/webappsec-csp/#reporting
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string      `json:"documentURL"`
+		Referrer           string      `json:"referrer"`
+		BlockedURL         string      `json:"blockedURL"`
+		EffectiveDirective string      `json:"effectiveDirective"`
+		OriginalPolicy     string      `json:"originalPolicy"`
+		Disposition        Disposition `json:"disposition"`
+		StatusCode         int         `json:"statusCode"`
+		Sample             string      `json:"sample"`
+		SourceFile         string      `json:"sourceFile"`
+		LineNumber         int         `json:"lineNumber"`
+		ColumnNumber       int         `json:"columnNumber"`
+	} `json:"body"`
+}
+
+// parseReports parses the CSP reports in a request body of the provided content type
+// Reporting API bodies may contain multiple reports, of which only CSP violations are returned.
+func parseReports(contentType string, body []byte) ([]Report, error) {
+	if contentType == ReportContentType {
+		rep := cspReport{}
+		err := json.Unmarshal(body, &rep)
+		if err != nil {
+			return nil, err
+		}
+		return []Report{rep.Report}, nil
+	}
+
+	reps := make([]reportingAPIReport, 0)
+	err := json.Unmarshal(body, &reps)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]Report, 0, len(reps))
+	for _, r := range reps {
+		if r.Type != "csp-violation" {
+			continue
+		}
+		reports = append(reports, Report{
+			DocumentURI:        r.Body.DocumentURL,
+			Referrer:           r.Body.Referrer,
+			BlockedURI:         r.Body.BlockedURL,
+			EffectiveDirective: r.Body.EffectiveDirective,
+			ViolatedDirective:  r.Body.EffectiveDirective,
+			OriginalPolicy:     r.Body.OriginalPolicy,
+			Disposition:        r.Body.Disposition,
+			StatusCode:         r.Body.StatusCode,
+			Sample:             r.Body.Sample,
+			SourceFile:         r.Body.SourceFile,
+			LineNumber:         r.Body.LineNumber,
+			ColumnNumber:       r.Body.ColumnNumber,
+		})
+	}
+
+	return reports, nil
+}
+
+// DecodeReports decodes a stream of CSP reports, for offline analysis of stored reports
+// The stream may contain bare reports, reports in the report-uri {"csp-report": ...} wrapper,
+// Reporting API reports or arrays of these, in sequence (eg. newline delimited JSON).
+// Reporting API reports other than CSP violations are skipped.
+func DecodeReports(r io.Reader) ([]Report, error) {
+	reports := make([]Report, 0)
+
+	dec := json.NewDecoder(r)
+	for {
+		raw := json.RawMessage{}
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return reports, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		reps, err := decodeReport(raw)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, reps...)
+	}
+}
+
+// decodeReport decodes a single JSON value of one of the forms accepted by DecodeReports
+func decodeReport(raw json.RawMessage) ([]Report, error) {
+	if len(raw) != 0 && raw[0] == '[' {
+		items := make([]json.RawMessage, 0)
+		err := json.Unmarshal(raw, &items)
+		if err != nil {
+			return nil, err
+		}
+
+		reports := make([]Report, 0, len(items))
+		for _, item := range items {
+			reps, err := decodeReport(item)
+			if err != nil {
+				return nil, err
+			}
+			reports = append(reports, reps...)
+		}
+		return reports, nil
+	}
+
+	fields := make(map[string]json.RawMessage)
+	err := json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case fields["csp-report"] != nil:
+		return parseReports(ReportContentType, raw)
+	case fields["type"] != nil && fields["body"] != nil:
+		return parseReports(ReportsContentType, append(append([]byte{'['}, raw...), ']'))
+	default:
+		rep := Report{}
+		err := json.Unmarshal(raw, &rep)
+		if err != nil {
+			return nil, err
+		}
+		return []Report{rep}, nil
+	}
+}
+
 // ReportHandler is an interface that handles receiving CSP reports
 type ReportHandler interface {
 	Report(r Report) error
 }
 
+// ReportHandlerCtx is an extended ReportHandler interface with access to the request context and metadata
+// RouteHandler prefers this interface where a passed handler implements it
+type ReportHandlerCtx interface {
+	ReportCtx(ctx context.Context, r *http.Request, rep Report) error
+}
+
 type defaultLogReporter struct{}
 
 // LogReporter is a ReportHandler that logs CSP reports
@@ -46,6 +233,63 @@ func (l *defaultLogReporter) Report(r Report) error {
 	return nil
 }
 
+// ReportSanitizer is an interface that transforms CSP reports before they are passed to the ReportHandler,
+// for example to strip personal information
+type ReportSanitizer interface {
+	Sanitize(r Report) Report
+}
+
+// URISanitizer is a ReportSanitizer that strips query strings and fragments from report URIs
+type URISanitizer struct{}
+
+// Sanitize strips query strings and fragments from the document, referrer and blocked URIs
+func (u URISanitizer) Sanitize(r Report) Report {
+	r.DocumentURI = stripQuery(r.DocumentURI)
+	r.Referrer = stripQuery(r.Referrer)
+	r.BlockedURI = stripQuery(r.BlockedURI)
+	return r
+}
+
+// stripQuery removes any query string and fragment from a URI
+func stripQuery(uri string) string {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
+
+type slogReporter struct {
+	logger *slog.Logger
+}
+
+// NewSlogReporter creates a ReportHandler that logs CSP reports with structured attributes
+// A nil logger uses slog.Default()
+func NewSlogReporter(logger *slog.Logger) ReportHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogReporter{logger}
+}
+
+// Report logs a CSP report with an attribute per report field
+func (s *slogReporter) Report(r Report) error {
+	s.logger.Info("CSP report",
+		slog.String("document-uri", r.DocumentURI),
+		slog.String("referrer", r.Referrer),
+		slog.String("blocked-uri", r.BlockedURI),
+		slog.String("effective-directive", r.EffectiveDirective),
+		slog.String("violated-directive", r.ViolatedDirective),
+		slog.String("original-policy", r.OriginalPolicy),
+		slog.String("disposition", string(r.Disposition)),
+		slog.Int("status", r.StatusCode),
+		slog.String("script-sample", r.Sample),
+		slog.String("source-file", r.SourceFile),
+		slog.Int("line-number", r.LineNumber),
+		slog.Int("column-number", r.ColumnNumber),
+	)
+	return nil
+}
+
 // ErrorHandler is a function that handles errors in the CSR report handler endpoint
 type ErrorHandler interface {
 	Error(w http.ResponseWriter, r *http.Request, status int, err error)
@@ -56,52 +300,194 @@ type defaultErrorHandler struct{}
 // DefaultErrorHandler logs and returns errors to requester
 func (e *defaultErrorHandler) Error(w http.ResponseWriter, r *http.Request, status int, err error) {
 	log.Println(err)
-	w.Write([]byte(err.Error()))
 	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+}
+
+// readBody reads a report body of at most limit bytes, decompressing gzip encoded bodies
+// The limit applies to both the encoded and decoded body to guard against decompression bombs,
+// on error the HTTP status to respond with is returned.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, int, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, limit)
+	defer r.Body.Close()
+
+	tooLarge := fmt.Errorf("Report body too large (limit %d bytes)", limit)
+	var maxBytesErr *http.MaxBytesError
+
+	switch enc := strings.ToLower(r.Header.Get("Content-Encoding")); enc {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if errors.As(err, &maxBytesErr) {
+			return nil, http.StatusRequestEntityTooLarge, tooLarge
+		} else if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, limit+1)
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("Unsupported content encoding %s (expected gzip)", enc)
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if errors.As(err, &maxBytesErr) || int64(len(b)) > limit {
+		return nil, http.StatusRequestEntityTooLarge, tooLarge
+	} else if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return b, 0, nil
 }
 
 // Handler creates a CSR Report handler for binding to a route
-// This accepts and ErrorHandler and/or ReportHandler argument(s) to override default error and report handers
+// This accepts and ErrorHandler and/or ReportHandler (or ReportHandlerCtx) argument(s) to override default error and report handers,
+// an optional ReportSanitizer to transform reports before they are handled,
+// optional Deduplicate, RateLimit and TrustedProxies options to limit report floods (unlimited by default),
+// a MaxBodySize option to override the DefaultMaxBodySize limit, a DebugBodySize option to include rejected bodies in errors
+// and an Async option to process reports in the background
 func RouteHandler(opts ...interface{}) http.HandlerFunc {
 	var reportHandler ReportHandler = &defaultLogReporter{}
+	var reportHandlerCtx ReportHandlerCtx
 	var errorHandler ErrorHandler = &defaultErrorHandler{}
+	var sanitizer ReportSanitizer
+	var proxies TrustedProxies
+	var dedup, limiter *windowCache
+	key := dedupKey
+	var async *Async
+	rateLimit := 0
+	maxBodySize := int64(DefaultMaxBodySize)
+	debugBodySize := 0
 	for _, opt := range opts {
+		switch o := opt.(type) {
+		case MaxBodySize:
+			maxBodySize = int64(o)
+		case DebugBodySize:
+			debugBodySize = int(o)
+		case Deduplicate:
+			dedup = newWindowCache(o.Size, o.Window)
+			if o.Key != nil {
+				key = o.Key
+			}
+		case RateLimit:
+			if o.Limit > 0 {
+				limiter, rateLimit = newWindowCache(o.Size, o.Window), o.Limit
+			}
+		case TrustedProxies:
+			proxies = o
+		case Async:
+			async = &o
+		}
+		if s, ok := opt.(ReportSanitizer); ok {
+			sanitizer = s
+		}
 		if r, ok := opt.(ReportHandler); ok {
 			reportHandler = r
 		}
+		if r, ok := opt.(ReportHandlerCtx); ok {
+			reportHandlerCtx = r
+		}
 		if e, ok := opt.(ErrorHandler); ok {
 			log.Printf("Error override")
 			errorHandler = e
 		}
 	}
 
+	handle := func(ctx context.Context, r *http.Request, rep Report) error {
+		if reportHandlerCtx != nil {
+			return reportHandlerCtx.ReportCtx(ctx, r, rep)
+		}
+		return reportHandler.Report(rep)
+	}
+
+	var queue *asyncQueue
+	if async != nil {
+		queue = async.start(handle)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		contentType := r.Header.Get("Content-Type")
-		if contentType != ReportContentType {
-			errorHandler.Error(w, r, http.StatusUnsupportedMediaType, fmt.Errorf("Unsupported content type (expected %s)", ReportContentType))
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			errorHandler.Error(w, r, http.StatusMethodNotAllowed, fmt.Errorf("Unsupported method %s (expected %s)", r.Method, http.MethodPost))
 			return
 		}
 
-		body, err := ioutil.ReadAll(r.Body)
-		defer r.Body.Close()
-		if err != nil {
-			errorHandler.Error(w, r, http.StatusBadRequest, err)
+		if ip := proxies.ClientIP(r); limiter != nil && ip != nil && limiter.hit(ip.String()) > rateLimit {
+			errorHandler.Error(w, r, http.StatusTooManyRequests, fmt.Errorf("Report rate limit exceeded"))
 			return
 		}
 
-		rep := cspReport{}
-		err = json.Unmarshal(body, &rep)
-		if err != nil {
-			errorHandler.Error(w, r, http.StatusBadRequest, err)
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || (contentType != ReportContentType && contentType != ReportsContentType) {
+			errorHandler.Error(w, r, http.StatusUnsupportedMediaType, fmt.Errorf("Unsupported content type (expected %s or %s)", ReportContentType, ReportsContentType))
 			return
 		}
 
-		err = reportHandler.Report(rep.Report)
+		// Skip reading and handling reports once the client has gone away, nobody is left to respond to
+		if r.Context().Err() != nil {
+			return
+		}
+
+		body, status, err := readBody(w, r, maxBodySize)
+		if r.Context().Err() != nil {
+			return
+		} else if err != nil {
+			errorHandler.Error(w, r, status, err)
+			return
+		}
+
+		reports, err := parseReports(contentType, body)
+		if err != nil && debugBodySize > 0 {
+			if len(body) > debugBodySize {
+				body = body[:debugBodySize]
+			}
+			err = &BodyError{err, append([]byte{}, body...)}
+		}
 		if err != nil {
-			errorHandler.Error(w, r, http.StatusInternalServerError, err)
+			errorHandler.Error(w, r, http.StatusBadRequest, err)
 			return
 		}
 
+		// Disposition is omitted by older browsers
+		for _, rep := range reports {
+			if d := rep.Disposition; d != "" && !d.Valid() {
+				errorHandler.Error(w, r, http.StatusBadRequest, fmt.Errorf("Invalid report disposition %q (expected %s or %s)", d, DispositionEnforce, DispositionReport))
+				return
+			}
+		}
+
+		for _, rep := range reports {
+			if dedup != nil && dedup.hit(key(rep)) > 1 {
+				continue
+			}
+
+			if sanitizer != nil {
+				rep = sanitizer.Sanitize(rep)
+			}
+
+			if queue != nil {
+				// Detach from the request context, which is cancelled once the response is sent
+				ctx := context.WithoutCancel(r.Context())
+				if err := async.enqueue(queue, asyncReport{ctx, r.WithContext(ctx), rep}); err != nil {
+					errorHandler.Error(w, r, http.StatusServiceUnavailable, err)
+					return
+				}
+				continue
+			}
+
+			if r.Context().Err() != nil {
+				return
+			}
+			err = handle(r.Context(), r, rep)
+			if err != nil {
+				errorHandler.Error(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		if queue != nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
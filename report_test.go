@@ -0,0 +1,534 @@
+package csp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sensitiveReportString = `{
+	"csp-report": {
+	  "document-uri": "http://example.com/account?token=secret#details",
+	  "referrer": "http://example.com/login?user=someone",
+	  "blocked-uri": "http://evil.example.com/track.js?id=1234",
+	  "violated-directive": "script-src 'self'",
+	  "original-policy": "default-src 'none'; script-src 'self'",
+	  "disposition": "enforce"
+	}
+}`
+
+const reportsString = `[{
+	"type": "csp-violation",
+	"age": 10,
+	"url": "https://example.com/signup.html",
+	"user_agent": "test-agent",
+	"body": {
+	  "documentURL": "https://example.com/signup.html",
+	  "referrer": "https://example.com/",
+	  "blockedURL": "inline",
+	  "effectiveDirective": "script-src-elem",
+	  "originalPolicy": "script-src 'self' 'report-sample'; report-to csp-endpoint",
+	  "disposition": "enforce",
+	  "statusCode": 200,
+	  "sample": "console.log(\"lo\")",
+	  "sourceFile": "https://example.com/js/app.js",
+	  "lineNumber": 12,
+	  "columnNumber": 34
+	}
+}, {
+	"type": "deprecation",
+	"url": "https://example.com/signup.html",
+	"body": {}
+}]`
+
+type MockErrorHandler struct {
+	status int
+	err    error
+}
+
+func (m *MockErrorHandler) Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	m.status, m.err = status, err
+	w.WriteHeader(status)
+}
+
+type MockReporterCtx struct {
+	r         Report
+	userAgent string
+}
+
+func (mr *MockReporterCtx) ReportCtx(ctx context.Context, r *http.Request, rep Report) error {
+	mr.r = rep
+	mr.userAgent = r.UserAgent()
+	return nil
+}
+
+func TestRouteHandler(t *testing.T) {
+
+	t.Run("Reject unsupported method", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr)
+
+		h(rw, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+		assert.Equal(t, http.MethodPost, rw.Header().Get("Allow"))
+		assert.Equal(t, 0, mr.n)
+	})
+
+	t.Run("Reject unsupported content type", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", "text/plain")
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr)
+
+		h(rw, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+		assert.Equal(t, 0, mr.n)
+	})
+
+	t.Run("Accept content type with charset", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType+"; charset=utf-8")
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr)
+
+		h(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, 1, mr.n)
+	})
+
+	t.Run("Structured logging reporter", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		buf := bytes.Buffer{}
+		h := RouteHandler(NewSlogReporter(slog.New(slog.NewJSONHandler(&buf, nil))))
+
+		h(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, buf.String(), `"blocked-uri":"http://example.com/css/style.css"`)
+		assert.Contains(t, buf.String(), `"violated-directive":"style-src cdn.example.com"`)
+	})
+
+	t.Run("Reject oversized body", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr, MaxBodySize(64))
+
+		h(rw, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		assert.Equal(t, 0, mr.n)
+	})
+
+	t.Run("Gzip encoded reports", func(t *testing.T) {
+		gzipped := func(body string) *bytes.Buffer {
+			buf := bytes.Buffer{}
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(body))
+			gz.Close()
+			return &buf
+		}
+
+		req := httptest.NewRequest("POST", "/", gzipped(reportString))
+		req.Header.Set("Content-Type", ReportContentType)
+		req.Header.Set("Content-Encoding", "gzip")
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		RouteHandler(&mr)(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "http://example.com/signup.html", mr.r.DocumentURI)
+
+		// Decompressed size is limited
+		bomb := gzipped(strings.Repeat(" ", 1024*1024))
+		req = httptest.NewRequest("POST", "/", bomb)
+		req.Header.Set("Content-Type", ReportContentType)
+		req.Header.Set("Content-Encoding", "gzip")
+		rw = httptest.NewRecorder()
+
+		RouteHandler(&mr)(rw, req)
+		assert.True(t, bomb.Len() < DefaultMaxBodySize)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+
+		req = httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		req.Header.Set("Content-Encoding", "br")
+		rw = httptest.NewRecorder()
+
+		RouteHandler(&mr)(rw, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+		assert.Equal(t, 1, mr.n)
+	})
+
+	t.Run("Report with request context", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		req.Header.Set("User-Agent", "test-agent")
+		rw := httptest.NewRecorder()
+
+		mr := MockReporterCtx{}
+		h := RouteHandler(&mr)
+
+		h(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "test-agent", mr.userAgent)
+		assert.Equal(t, "http://example.com/signup.html", mr.r.DocumentURI)
+	})
+
+	t.Run("Skip reports for cancelled requests", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString))).WithContext(ctx)
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		a := NewAggregatingReporter()
+		h := RouteHandler(a)
+
+		h(rw, req)
+		assert.Empty(t, a.Snapshot())
+		assert.Empty(t, rw.Body.String())
+	})
+
+	t.Run("Sanitize reports", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(sensitiveReportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr, URISanitizer{})
+
+		h(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "http://example.com/account", mr.r.DocumentURI)
+		assert.Equal(t, "http://example.com/login", mr.r.Referrer)
+		assert.Equal(t, "http://evil.example.com/track.js", mr.r.BlockedURI)
+	})
+
+	t.Run("Reports are unchanged without a sanitizer", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(sensitiveReportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr)
+
+		h(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "http://example.com/account?token=secret#details", mr.r.DocumentURI)
+	})
+
+	t.Run("Deduplicate reports", func(t *testing.T) {
+		mr := MockReporter{}
+		h := RouteHandler(&mr, Deduplicate{Window: time.Minute})
+
+		for _, body := range []string{reportString, reportString, sensitiveReportString} {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", ReportContentType)
+			rw := httptest.NewRecorder()
+
+			h(rw, req)
+			assert.Equal(t, http.StatusOK, rw.Code)
+		}
+
+		assert.Equal(t, 2, mr.n)
+	})
+
+	t.Run("Deduplicate reports with custom key", func(t *testing.T) {
+		now := time.Now()
+		timeNow = func() time.Time { return now }
+		defer func() { timeNow = time.Now }()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr, Deduplicate{Window: time.Minute, Key: func(r Report) string {
+			return stripQuery(r.DocumentURI)
+		}})
+
+		bodies := []string{
+			sensitiveReportString,
+			strings.Replace(sensitiveReportString, "token=secret", "token=other", 1),
+			reportString,
+		}
+		for _, body := range bodies {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", ReportContentType)
+			h(httptest.NewRecorder(), req)
+		}
+		assert.Equal(t, 2, mr.n)
+
+		// Duplicates are accepted once the window expires
+		now = now.Add(2 * time.Minute)
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(sensitiveReportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		h(httptest.NewRecorder(), req)
+		assert.Equal(t, 3, mr.n)
+	})
+
+	t.Run("Deduplicate window expires", func(t *testing.T) {
+		now := time.Now()
+		timeNow = func() time.Time { return now }
+		defer func() { timeNow = time.Now }()
+
+		mr := MockReporter{}
+		h := RouteHandler(&mr, Deduplicate{Window: time.Minute})
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+			req.Header.Set("Content-Type", ReportContentType)
+			h(httptest.NewRecorder(), req)
+			now = now.Add(2 * time.Minute)
+		}
+
+		assert.Equal(t, 2, mr.n)
+	})
+
+	t.Run("Rate limit clients", func(t *testing.T) {
+		mr := MockReporter{}
+		h := RouteHandler(&mr, RateLimit{Limit: 1, Window: time.Minute})
+
+		codes := make([]int, 0)
+		for _, remote := range []string{"192.0.2.1:1234", "192.0.2.1:1235", "192.0.2.2:1234"} {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+			req.Header.Set("Content-Type", ReportContentType)
+			req.RemoteAddr = remote
+			rw := httptest.NewRecorder()
+
+			h(rw, req)
+			codes = append(codes, rw.Code)
+		}
+
+		assert.EqualValues(t, []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK}, codes)
+		assert.Equal(t, 2, mr.n)
+	})
+
+	t.Run("Rate limit skips unlimited and unknown clients", func(t *testing.T) {
+		for _, tc := range []struct {
+			limit  RateLimit
+			remote string
+		}{
+			{RateLimit{Limit: 0, Window: time.Minute}, "192.0.2.1:1234"},
+			{RateLimit{Limit: 1, Window: time.Minute}, "@"},
+		} {
+			mr := MockReporter{}
+			h := RouteHandler(&mr, tc.limit)
+
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+				req.Header.Set("Content-Type", ReportContentType)
+				req.RemoteAddr = tc.remote
+				rw := httptest.NewRecorder()
+
+				h(rw, req)
+				assert.Equal(t, http.StatusOK, rw.Code, tc.remote)
+			}
+			assert.Equal(t, 3, mr.n, tc.remote)
+		}
+	})
+
+	t.Run("Validate report disposition", func(t *testing.T) {
+		for disposition, code := range map[string]int{
+			"enforce": http.StatusOK,
+			"report":  http.StatusOK,
+			"blocked": http.StatusBadRequest,
+		} {
+			body := strings.Replace(sensitiveReportString, `"disposition": "enforce"`, `"disposition": "`+disposition+`"`, 1)
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", ReportContentType)
+			rw := httptest.NewRecorder()
+
+			mr := MockReporter{}
+			RouteHandler(&mr)(rw, req)
+			assert.Equal(t, code, rw.Code, disposition)
+			if code == http.StatusOK {
+				assert.Equal(t, Disposition(disposition), mr.r.Disposition)
+			} else {
+				assert.Equal(t, 0, mr.n)
+			}
+		}
+	})
+
+	t.Run("Include malformed bodies in errors", func(t *testing.T) {
+		body := `{"csp-report": {"blocked-uri": "inline", "line-number": "twelve"}}`
+
+		for size, snippet := range map[int]string{0: "", 16: body[:16], 1024: body} {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", ReportContentType)
+			rw := httptest.NewRecorder()
+
+			eh := MockErrorHandler{}
+			opts := []interface{}{&MockReporter{}, &eh}
+			if size > 0 {
+				opts = append(opts, DebugBodySize(size))
+			}
+			RouteHandler(opts...)(rw, req)
+			assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+			bodyErr := &BodyError{}
+			if snippet == "" {
+				assert.False(t, errors.As(eh.err, &bodyErr))
+				continue
+			}
+			require.True(t, errors.As(eh.err, &bodyErr))
+			assert.Equal(t, snippet, string(bodyErr.Body))
+			assert.Contains(t, eh.err.Error(), "json")
+		}
+	})
+
+	t.Run("Report script sample", func(t *testing.T) {
+		body := strings.Replace(sensitiveReportString, `"disposition": "enforce"`, `"disposition": "enforce", "script-sample": "alert(1)"`, 1)
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		RouteHandler(&mr)(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "alert(1)", mr.r.Sample)
+	})
+
+	t.Run("Reporting API reports", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportsString)))
+		req.Header.Set("Content-Type", ReportsContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		RouteHandler(&mr)(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, 1, mr.n)
+		assert.Equal(t, Report{
+			DocumentURI:        "https://example.com/signup.html",
+			Referrer:           "https://example.com/",
+			BlockedURI:         "inline",
+			EffectiveDirective: "script-src-elem",
+			ViolatedDirective:  "script-src-elem",
+			OriginalPolicy:     "script-src 'self' 'report-sample'; report-to csp-endpoint",
+			Disposition:        DispositionEnforce,
+			StatusCode:         200,
+			Sample:             `console.log("lo")`,
+			SourceFile:         "https://example.com/js/app.js",
+			LineNumber:         12,
+			ColumnNumber:       34,
+		}, mr.r)
+	})
+
+	t.Run("Report violation location", func(t *testing.T) {
+		body := `{
+	"csp-report": {
+	  "document-uri": "https://example.com/signup.html",
+	  "referrer": "",
+	  "blocked-uri": "eval",
+	  "effective-directive": "script-src",
+	  "violated-directive": "script-src",
+	  "original-policy": "script-src 'self' 'report-sample'",
+	  "disposition": "enforce",
+	  "status": 200,
+	  "script-sample": "eval(input)",
+	  "source-file": "https://example.com/js/app.js",
+	  "line-number": 7,
+	  "column-number": 21
+	}
+}`
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		RouteHandler(&mr)(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "https://example.com/js/app.js", mr.r.SourceFile)
+		assert.Equal(t, 7, mr.r.LineNumber)
+		assert.Equal(t, 21, mr.r.ColumnNumber)
+	})
+
+	t.Run("Report effective directive and status", func(t *testing.T) {
+		body := strings.Replace(sensitiveReportString, `"disposition": "enforce"`, `"disposition": "enforce", "effective-directive": "script-src-elem", "status": 200`, 1)
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		mr := MockReporter{}
+		RouteHandler(&mr)(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "script-src-elem", mr.r.EffectiveDirective)
+		assert.Equal(t, 200, mr.r.StatusCode)
+	})
+
+}
+
+func TestDecodeReports(t *testing.T) {
+	wrapped := Report{
+		DocumentURI:       "http://example.com/account?token=secret#details",
+		Referrer:          "http://example.com/login?user=someone",
+		BlockedURI:        "http://evil.example.com/track.js?id=1234",
+		ViolatedDirective: "script-src 'self'",
+		OriginalPolicy:    "default-src 'none'; script-src 'self'",
+		Disposition:       DispositionEnforce,
+	}
+
+	t.Run("Bare report", func(t *testing.T) {
+		reports, err := DecodeReports(strings.NewReader(`{"blocked-uri": "inline", "violated-directive": "script-src"}`))
+		assert.Nil(t, err)
+		assert.EqualValues(t, []Report{{BlockedURI: "inline", ViolatedDirective: "script-src"}}, reports)
+	})
+
+	t.Run("Wrapped report", func(t *testing.T) {
+		reports, err := DecodeReports(strings.NewReader(sensitiveReportString))
+		assert.Nil(t, err)
+		assert.EqualValues(t, []Report{wrapped}, reports)
+	})
+
+	t.Run("Reporting API array", func(t *testing.T) {
+		reports, err := DecodeReports(strings.NewReader(reportsString))
+		assert.Nil(t, err)
+		assert.Len(t, reports, 1)
+		assert.Equal(t, "script-src-elem", reports[0].ViolatedDirective)
+		assert.Equal(t, 12, reports[0].LineNumber)
+	})
+
+	t.Run("Newline delimited reports", func(t *testing.T) {
+		lines := []string{
+			`{"csp-report": {"blocked-uri": "inline", "violated-directive": "script-src"}}`,
+			`{"type": "csp-violation", "body": {"blockedURL": "eval", "effectiveDirective": "script-src"}}`,
+			`{"type": "deprecation", "body": {}}`,
+			`{"blocked-uri": "data", "violated-directive": "img-src"}`,
+		}
+
+		reports, err := DecodeReports(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+		assert.Nil(t, err)
+		assert.EqualValues(t, []Report{
+			{BlockedURI: "inline", ViolatedDirective: "script-src"},
+			{BlockedURI: "eval", EffectiveDirective: "script-src", ViolatedDirective: "script-src"},
+			{BlockedURI: "data", ViolatedDirective: "img-src"},
+		}, reports)
+	})
+
+	t.Run("Invalid input", func(t *testing.T) {
+		_, err := DecodeReports(strings.NewReader(`{"blocked-uri": "inline"}` + "\n{"))
+		assert.NotNil(t, err)
+
+		_, err = DecodeReports(strings.NewReader(`"inline"`))
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,72 @@
+package csp
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ReportingGroup describes a Report-To endpoint group
+type ReportingGroup struct {
+	Name     string // Name of the group, referenced by the report-to directive
+	Endpoint string // Endpoint URL reports are sent to
+	MaxAge   int    // MaxAge in seconds for which browsers cache the group
+}
+
+// reportToGroup is the JSON form of a group in the Report-To header
+type reportToGroup struct {
+	Group     string             `json:"group"`
+	MaxAge    int                `json:"max_age"`
+	Endpoints []reportToEndpoint `json:"endpoints"`
+}
+
+type reportToEndpoint struct {
+	URL string `json:"url"`
+}
+
+// AddReportingGroup sets report-to to the group name and records the group, so Handler emits a matching Report-To header
+func (c *CSP) AddReportingGroup(g ReportingGroup) {
+	c.ReportTo = g.Name
+	c.ReportingGroups = append(c.ReportingGroups, g)
+}
+
+// mergeGroups combines reporting groups, with groups taking precedence over defaults of the same name
+func mergeGroups(groups, defaults []ReportingGroup) []ReportingGroup {
+	if groups == nil && defaults == nil {
+		return nil
+	}
+
+	merged := append([]ReportingGroup{}, groups...)
+	for _, d := range defaults {
+		found := false
+		for _, g := range groups {
+			found = found || g.Name == d.Name
+		}
+		if !found {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+// ReportToHeader formats the Report-To header value for the policy reporting groups
+// This returns an empty string where no groups are set.
+func (c CSP) ReportToHeader() (string, error) {
+	groups, err := c.reportToGroups()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(groups, ", "), nil
+}
+
+// reportToGroups formats each reporting group as a Report-To header entry
+func (c CSP) reportToGroups() ([]string, error) {
+	groups := make([]string, len(c.ReportingGroups))
+	for i, g := range c.ReportingGroups {
+		b, err := json.Marshal(reportToGroup{g.Name, g.MaxAge, []reportToEndpoint{{g.Endpoint}}})
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = string(b)
+	}
+	return groups, nil
+}
@@ -0,0 +1,33 @@
+package csp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportingGroups(t *testing.T) {
+	c := Default()
+	c.AddReportingGroup(ReportingGroup{Name: "csp-endpoint", Endpoint: "https://example.com/_/csp-reports", MaxAge: 86400})
+
+	t.Run("Header value", func(t *testing.T) {
+		h, err := c.ReportToHeader()
+		require.Nil(t, err)
+		assert.Equal(t, `{"group":"csp-endpoint","max_age":86400,"endpoints":[{"url":"https://example.com/_/csp-reports"}]}`, h)
+
+		h, err = Default().ReportToHeader()
+		require.Nil(t, err)
+		assert.Empty(t, h)
+	})
+
+	t.Run("Handler sets directive and header", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, DefaultPolicy+"; report-to csp-endpoint", rw.Header().Get(HeaderPolicy))
+		assert.Equal(t, `{"group":"csp-endpoint","max_age":86400,"endpoints":[{"url":"https://example.com/_/csp-reports"}]}`, rw.Header().Get(HeaderReportTo))
+	})
+}
@@ -0,0 +1,67 @@
+package csp
+
+import "net/http"
+
+// cspRoundTripper wraps a snapshot of a CSP configuration, attaching CSP headers to responses from the
+// underlying RoundTripper
+type cspRoundTripper struct {
+	policy CSP
+	next   http.RoundTripper
+}
+
+// RoundTrip performs the request with the underlying RoundTripper, then sets CSP headers on the response
+// replacing any policies set by the upstream server. Responses excluded by HTMLOnly or SkipStatus are returned
+// unmodified, using the response Content-Type as sent by the upstream server.
+func (c *cspRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+
+	if skipResponse(resp.StatusCode, resp.Header.Get("Content-Type"), c.policy.HTMLOnly, c.policy.SkipStatus) {
+		return resp, nil
+	}
+
+	key := HeaderPolicy
+	if c.policy.ReportOnly {
+		key = HeaderReportOnly
+	}
+
+	val, _ := c.policy.MarshalText()
+
+	if len(c.policy.ReportingGroups) != 0 {
+		groups, err := c.policy.ReportToHeader()
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Header.Set(HeaderReportTo, groups)
+	}
+
+	resp.Header.Del(HeaderPolicy)
+	resp.Header.Del(HeaderReportOnly)
+	resp.Header.Set(key, string(val))
+
+	return resp, nil
+}
+
+// RoundTripper wraps an http.RoundTripper in a CSP instance, for reverse proxies attaching policies to proxied responses
+// As with Handler the RoundTripper holds a copy of the policy, a nil RoundTripper uses http.DefaultTransport.
+// Per-request nonces are not generated as proxied response bodies cannot use them, so Nonce is ignored and
+// NoncePlaceholder sources are removed (directives left without sources are set to 'none', see MapSources).
+func (c *CSP) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	p := c.MapSources(func(directive, source string) string {
+		if source == NoncePlaceholder {
+			return ""
+		}
+		return source
+	})
+	return &cspRoundTripper{p, next}
+}
@@ -0,0 +1,101 @@
+package csp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRoundTripper returns a fixed response or error
+type mockRoundTripper struct {
+	status int
+	header http.Header
+	err    error
+}
+
+func (m *mockRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	status := m.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Header: m.header.Clone(), Body: ioutil.NopCloser(strings.NewReader("ok")), Request: r}, nil
+}
+
+func TestRoundTripper(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://upstream.example.com/", nil)
+
+	t.Run("Overrides upstream policy", func(t *testing.T) {
+		c := Default()
+		rt := c.RoundTripper(&mockRoundTripper{header: http.Header{HeaderPolicy: {"default-src *"}}})
+
+		resp, err := rt.RoundTrip(req)
+		require.Nil(t, err)
+		assert.Equal(t, DefaultPolicy, resp.Header.Get(HeaderPolicy))
+		assert.Empty(t, resp.Header.Get(HeaderReportOnly))
+	})
+
+	t.Run("Report only policy", func(t *testing.T) {
+		c := Default().AsReportOnly()
+		rt := c.RoundTripper(&mockRoundTripper{})
+
+		resp, err := rt.RoundTrip(req)
+		require.Nil(t, err)
+		assert.Equal(t, DefaultPolicy, resp.Header.Get(HeaderReportOnly))
+		assert.Empty(t, resp.Header.Get(HeaderPolicy))
+	})
+
+	t.Run("Replaces upstream policies of either kind", func(t *testing.T) {
+		c := Default().AsReportOnly()
+		rt := c.RoundTripper(&mockRoundTripper{header: http.Header{HeaderPolicy: {"default-src *"}, HeaderReportOnly: {"default-src *"}}})
+
+		resp, err := rt.RoundTrip(req)
+		require.Nil(t, err)
+		assert.Equal(t, []string{DefaultPolicy}, resp.Header.Values(HeaderReportOnly))
+		assert.Empty(t, resp.Header.Values(HeaderPolicy))
+	})
+
+	t.Run("Nonce placeholders are removed", func(t *testing.T) {
+		c := CSP{DefaultSrc: NewSourceList(SourceSelf), ScriptSrc: NewSourceList(NoncePlaceholder), StyleSrc: NewSourceList(SourceSelf, NoncePlaceholder)}
+		rt := c.RoundTripper(&mockRoundTripper{})
+
+		resp, err := rt.RoundTrip(req)
+		require.Nil(t, err)
+		assert.Equal(t, "default-src 'self'; script-src 'none'; style-src 'self'", resp.Header.Get(HeaderPolicy))
+	})
+
+	t.Run("Skipped responses are not modified", func(t *testing.T) {
+		c := Default()
+		c.HTMLOnly = true
+		c.SkipStatus = []int{http.StatusNotModified}
+
+		resp, err := c.RoundTripper(&mockRoundTripper{header: http.Header{"Content-Type": {"application/json"}}}).RoundTrip(req)
+		require.Nil(t, err)
+		assert.Empty(t, resp.Header.Get(HeaderPolicy))
+
+		resp, err = c.RoundTripper(&mockRoundTripper{status: http.StatusNotModified, header: http.Header{"Content-Type": {"text/html"}}}).RoundTrip(req)
+		require.Nil(t, err)
+		assert.Empty(t, resp.Header.Get(HeaderPolicy))
+
+		resp, err = c.RoundTripper(&mockRoundTripper{header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}}).RoundTrip(req)
+		require.Nil(t, err)
+		assert.Equal(t, DefaultPolicy, resp.Header.Get(HeaderPolicy))
+	})
+
+	t.Run("Upstream errors are returned", func(t *testing.T) {
+		c := Default()
+		upstream := errors.New("connection refused")
+
+		resp, err := c.RoundTripper(&mockRoundTripper{err: upstream}).RoundTrip(req)
+		assert.Nil(t, resp)
+		assert.Equal(t, upstream, err)
+	})
+}
@@ -0,0 +1,41 @@
+package csp
+
+import "net/http"
+
+// Companion security header keys
+const (
+	HeaderContentTypeOptions = "X-Content-Type-Options"
+	HeaderReferrerPolicy     = "Referrer-Policy"
+)
+
+// SecurityHeaders wraps a policy with security headers commonly deployed alongside CSP
+// Additional headers are opt-in, so a zero SecurityHeaders behaves as CSP.Handler.
+type SecurityHeaders struct {
+	CSP            CSP
+	NoSniff        bool   // NoSniff sets X-Content-Type-Options: nosniff
+	ReferrerPolicy string // ReferrerPolicy sets the Referrer-Policy header where set, eg. strict-origin-when-cross-origin
+}
+
+// securityHandler attaches companion security headers before calling the wrapped CSP handler
+type securityHandler struct {
+	noSniff        bool
+	referrerPolicy string
+	h              http.Handler
+}
+
+// ServeHTTP is an http.Handler instance that attaches enabled security headers and CSP headers to all requests
+func (s *securityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.noSniff {
+		w.Header().Set(HeaderContentTypeOptions, "nosniff")
+	}
+	if s.referrerPolicy != "" {
+		w.Header().Set(HeaderReferrerPolicy, s.referrerPolicy)
+	}
+
+	s.h.ServeHTTP(w, r)
+}
+
+// Handler wraps an http.Handler, attaching the policy and enabled security headers
+func (s SecurityHeaders) Handler(h http.Handler) http.Handler {
+	return &securityHandler{s.NoSniff, s.ReferrerPolicy, s.CSP.Handler(h)}
+}
@@ -0,0 +1,37 @@
+package csp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Headers disabled by default", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		SecurityHeaders{CSP: Default()}.Handler(next).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy))
+		assert.Empty(t, rw.Header().Get(HeaderContentTypeOptions))
+		assert.Empty(t, rw.Header().Get(HeaderReferrerPolicy))
+	})
+
+	t.Run("Enabled headers are set", func(t *testing.T) {
+		s := SecurityHeaders{
+			CSP:            Default(),
+			NoSniff:        true,
+			ReferrerPolicy: "strict-origin-when-cross-origin",
+		}
+
+		rw := httptest.NewRecorder()
+		s.Handler(next).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, DefaultPolicy, rw.Header().Get(HeaderPolicy))
+		assert.Equal(t, "nosniff", rw.Header().Get(HeaderContentTypeOptions))
+		assert.Equal(t, "strict-origin-when-cross-origin", rw.Header().Get(HeaderReferrerPolicy))
+	})
+}
@@ -0,0 +1,253 @@
+package csp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SourceError describes a malformed source
+type SourceError struct {
+	Directive string // Directive containing the source, if known
+	Source    string // Source that failed validation
+	Reason    string // Reason the source is invalid
+}
+
+// Error formats a source error
+func (e *SourceError) Error() string {
+	if e.Directive == "" {
+		return fmt.Sprintf("Invalid source %q (%s)", e.Source, e.Reason)
+	}
+	return fmt.Sprintf("Invalid source %q in %s (%s)", e.Source, e.Directive, e.Reason)
+}
+
+// keywords are the quoted keyword sources accepted in source lists
+var keywords = map[string]bool{
+	SourceNone:                   true,
+	SourceSelf:                   true,
+	SourceUnsafeInline:           true,
+	SourceUnsafeEval:             true,
+	SourceUnsafeHashes:           true,
+	SourceStrictDynamic:          true,
+	SourceReportSample:           true,
+	"'wasm-unsafe-eval'":         true,
+	"'unsafe-allow-redirects'":   true,
+	"'inline-speculation-rules'": true,
+
+	// Trusted types keywords
+	"'script'":           true,
+	"'allow-duplicates'": true,
+}
+
+// quotableKeywords are keywords commonly written without or with the wrong quotes
+// Browsers treat unquoted keywords as host names, so these are corrected when parsed.
+var quotableKeywords = map[string]bool{
+	SourceNone:           true,
+	SourceSelf:           true,
+	SourceUnsafeInline:   true,
+	SourceUnsafeEval:     true,
+	SourceUnsafeHashes:   true,
+	SourceStrictDynamic:  true,
+	SourceReportSample:   true,
+	"'wasm-unsafe-eval'": true,
+}
+
+// normalizeKeyword corrects unquoted or double quoted keywords to the single quoted form
+func normalizeKeyword(source string) string {
+	if strings.HasPrefix(source, "'") {
+		return source
+	}
+	if k := "'" + strings.Trim(source, "\"") + "'"; quotableKeywords[k] {
+		return k
+	}
+	return source
+}
+
+// directiveTokens lists the allowed values of directives accepting a fixed set of tokens rather than sources
+var directiveTokens = map[string][]string{
+	requireSRIFor:          {"script", "style"},
+	requireTrustedTypesFor: {"'script'"},
+}
+
+// quotedPrefixes are the prefixes of quoted nonce and hash sources
+var quotedPrefixes = []string{"'nonce-", "'sha256-", "'sha384-", "'sha512-"}
+
+// nameDirectives are directives whose values are names (eg. trusted types policies or MIME types) rather than host sources
+var nameDirectives = map[string]bool{
+	pluginTypes:  true,
+	trustedTypes: true,
+}
+
+// Host source grammar components
+var (
+	schemePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+	hostPattern   = regexp.MustCompile(`^[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)*$`)
+	portPattern   = regexp.MustCompile(`^([0-9]+|\*)$`)
+)
+
+// base64Pattern matches the CSP base64-value grammar used by nonces and hashes, allowing base64url and omitted padding
+var base64Pattern = regexp.MustCompile(`^[a-zA-Z0-9+/_-]+={0,2}$`)
+
+// validateNonceDirective checks a directive accepts nonce sources, these are only meaningful in fetch directives
+func validateNonceDirective(directive string) error {
+	if _, ok := fetchFallbacks[directive]; !ok && directive != defaultSrc {
+		return fmt.Errorf("Invalid nonce directive %s (expected a fetch directive)", directive)
+	}
+	return nil
+}
+
+// groupPattern matches valid report-to group names
+var groupPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validateGroup checks a report-to group name, returning an error if it is empty or malformed
+func validateGroup(group string) error {
+	if strings.Contains(group, "://") || strings.HasPrefix(group, "/") {
+		return fmt.Errorf("Invalid %s group %q (expected a group name, use %s for URLs)", reportTo, group, reportURI)
+	}
+	if !groupPattern.MatchString(group) {
+		return fmt.Errorf("Invalid %s group %q (expected letters, digits, - or _)", reportTo, group)
+	}
+	return nil
+}
+
+// ValidateSource checks that a single source is well formed
+func ValidateSource(source string) error {
+	if reason := validateSource(source, true); reason != "" {
+		return &SourceError{Source: source, Reason: reason}
+	}
+	return nil
+}
+
+// validateSource checks a source, returning the reason it is malformed or an empty string if valid
+// Unquoted sources are checked against the host source grammar when hosts is set.
+func validateSource(source string, hosts bool) string {
+	if source == NoncePlaceholder {
+		return ""
+	}
+	if source == "" {
+		return "empty source"
+	}
+	if strings.ContainsAny(source, " \t\r\n;,") {
+		return "sources may not contain whitespace, semicolons or commas"
+	}
+	if strings.HasPrefix(source, "\"") || quotableKeywords["'"+source+"'"] {
+		return "keywords must be single quoted"
+	}
+
+	if strings.HasPrefix(source, "'") {
+		if len(source) < 3 || !strings.HasSuffix(source, "'") {
+			return "unterminated quote"
+		}
+		if keywords[source] {
+			return ""
+		}
+		for _, p := range quotedPrefixes {
+			if strings.HasPrefix(source, p) && len(source) > len(p)+1 {
+				if !base64Pattern.MatchString(source[len(p) : len(source)-1]) {
+					return "expected a base64 value"
+				}
+				return ""
+			}
+		}
+		return "unknown keyword"
+	}
+
+	if strings.Contains(source, "'") {
+		return "unexpected quote"
+	}
+
+	if hosts {
+		return validateHostSource(source)
+	}
+
+	return ""
+}
+
+// validateHostSource checks a scheme or host source (eg. https:, *.example.com:443/path) against the CSP grammar
+func validateHostSource(source string) string {
+	if source == SourceAny {
+		return ""
+	}
+	if strings.HasSuffix(source, ":") && schemePattern.MatchString(strings.TrimSuffix(source, ":")) {
+		return ""
+	}
+
+	rest := source
+	if i := strings.Index(rest, "://"); i >= 0 {
+		if !schemePattern.MatchString(rest[:i]) {
+			return "invalid scheme"
+		}
+		rest = rest[i+3:]
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest = rest[:i]
+	}
+
+	host := rest
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		host = rest[:i]
+		if !portPattern.MatchString(rest[i+1:]) {
+			return "invalid port"
+		}
+	}
+
+	if host == SourceAny {
+		return ""
+	}
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+		return "wildcards must be the whole host or a leading *. label"
+	}
+	if !hostPattern.MatchString(strings.TrimPrefix(host, "*.")) {
+		return "invalid host"
+	}
+
+	return ""
+}
+
+// validateDirectiveSource checks a source or token is valid for a known directive, as used by Validate and Builder
+func validateDirectiveSource(directive, source string) error {
+	if tokens, ok := directiveTokens[directive]; ok {
+		if !SourceList(tokens).Contains(source) {
+			return &SourceError{directive, source, fmt.Sprintf("expected one of %s", strings.Join(tokens, ", "))}
+		}
+		return nil
+	}
+
+	if reason := validateSource(source, !nameDirectives[directive]); reason != "" {
+		return &SourceError{directive, source, reason}
+	}
+	return nil
+}
+
+// Validate checks that a policy is well formed, returning an error describing any malformed sources or values
+// Directives in Extra are not validated as their grammar is unknown.
+func (c CSP) Validate() error {
+	errs := make([]error, 0)
+
+	for _, d := range c.directives() {
+		for _, s := range *d.sources {
+			if err := validateDirectiveSource(d.name, s); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if c.WebRTC != "" && c.WebRTC != WebRTCAllow && c.WebRTC != WebRTCBlock {
+		errs = append(errs, fmt.Errorf("Invalid %s value %s (expected %s or %s)", webRTC, c.WebRTC, WebRTCAllow, WebRTCBlock))
+	}
+
+	for _, d := range c.NonceDirectives {
+		if err := validateNonceDirective(d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.ReportTo != "" {
+		if err := validateGroup(c.ReportTo); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package csp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+
+	t.Run("Default policy is valid", func(t *testing.T) {
+		assert.Nil(t, Default().Validate())
+	})
+
+	sourceTests := []struct {
+		source string
+		valid  bool
+	}{
+		{SourceSelf, true},
+		{SourceAny, true},
+		{"'nonce-abc123'", true},
+		{"'sha256-abc123='", true},
+		{"'sha256-!!'", false},
+		{"'nonce-%%%'", false},
+		{"'nonce-a-b_c+/=='", true},
+		{"https://cdn.example.com", true},
+		{"", false},
+		{"'self", false},
+		{"\"self\"", false},
+		{"self", false},
+		{"'bogus'", false},
+		{"cdn.example.com;", false},
+		{"https:", true},
+		{"data:", true},
+		{"*.example.com", true},
+		{"https://*.example.com:443/path/", true},
+		{"example.com:*", true},
+		{"https://*", true},
+		{"*example.com", false},
+		{"https://example.*", false},
+		{"cdn.*.example.com", false},
+		{"example.com:http", false},
+		{"1http://example.com", false},
+	}
+
+	for _, v := range sourceTests {
+		t.Run("Validate source "+v.source, func(t *testing.T) {
+			err := ValidateSource(v.source)
+			if v.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+
+	t.Run("Unmarshal corrects keyword quoting", func(t *testing.T) {
+		s := SourceList{}
+		err := s.UnmarshalText([]byte(`self "unsafe-inline" 'none' self.example.com`))
+		assert.Nil(t, err)
+		assert.EqualValues(t, NewSourceList(SourceSelf, SourceUnsafeInline, SourceNone, "self.example.com"), s)
+	})
+
+	t.Run("Validate webrtc values", func(t *testing.T) {
+		c := Default()
+		for _, v := range []string{WebRTCAllow, WebRTCBlock} {
+			c.WebRTC = v
+			assert.Nil(t, c.Validate())
+		}
+
+		c.WebRTC = "block"
+		assert.EqualError(t, c.Validate(), "Invalid webrtc value block (expected 'allow' or 'block')")
+	})
+
+	t.Run("Validate require-sri-for tokens", func(t *testing.T) {
+		c := Default()
+		c.RequireSRIFor = []string{"script", "style"}
+		assert.Nil(t, c.Validate())
+
+		c.RequireSRIFor = []string{"script", "img"}
+		assert.EqualError(t, c.Validate(), `Invalid source "img" in require-sri-for (expected one of script, style)`)
+	})
+
+	t.Run("Validate host source wildcards", func(t *testing.T) {
+		c := Default()
+		c.ScriptSrc = append(c.ScriptSrc, "*example.com")
+
+		err := c.Validate()
+		assert.EqualError(t, err, `Invalid source "*example.com" in script-src (wildcards must be the whole host or a leading *. label)`)
+
+		c = Default()
+		c.TrustedTypes = []string{"my-policy", "default"}
+		c.PluginTypes = []string{"application/pdf"}
+		assert.Nil(t, c.Validate())
+	})
+
+	t.Run("Validate report-to group", func(t *testing.T) {
+		c := Default()
+		for _, v := range []string{"csp-endpoint", "csp_endpoint_2"} {
+			c.ReportTo = v
+			assert.Nil(t, c.Validate())
+		}
+
+		c.ReportTo = "csp endpoint"
+		assert.EqualError(t, c.Validate(), `Invalid report-to group "csp endpoint" (expected letters, digits, - or _)`)
+
+		for _, v := range []string{"/_/csp-reports", "https://example.com/csp"} {
+			c.ReportTo = v
+			assert.EqualError(t, c.Validate(), fmt.Sprintf(`Invalid report-to group %q (expected a group name, use report-uri for URLs)`, v))
+		}
+
+		_, err := NewBuilder().ReportTo("").Build()
+		assert.EqualError(t, err, `Invalid report-to group "" (expected letters, digits, - or _)`)
+	})
+
+	t.Run("Validate names directive", func(t *testing.T) {
+		c := Default()
+		c.ImgSrc = append(c.ImgSrc, "'self")
+
+		err := c.Validate()
+		assert.EqualError(t, err, `Invalid source "'self" in img-src (unterminated quote)`)
+	})
+
+}
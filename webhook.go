@@ -0,0 +1,59 @@
+package csp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DefaultWebhookTimeout is the request timeout used by webhook reporters created without a client
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookReporter is a ReportHandler that POSTs reports as JSON to a webhook URL
+type WebhookReporter struct {
+	URL          string
+	Client       *http.Client
+	IgnoreErrors bool // IgnoreErrors logs delivery failures rather than returning them, so RouteHandler responds with success
+}
+
+// NewWebhookReporter creates a reporter forwarding reports to the provided URL
+// A nil client uses a client with the DefaultWebhookTimeout, set Client.Timeout to override this.
+func NewWebhookReporter(url string, client *http.Client) *WebhookReporter {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	return &WebhookReporter{URL: url, Client: client}
+}
+
+// Report POSTs a CSP report to the webhook, failing on delivery errors or non 2xx responses
+func (wh *WebhookReporter) Report(r Report) error {
+	err := wh.post(r)
+	if err != nil && wh.IgnoreErrors {
+		log.Println(err)
+		return nil
+	}
+	return err
+}
+
+// post marshals and sends a report to the webhook
+func (wh *WebhookReporter) post(r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := wh.Client.Post(wh.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook request failed (status %d)", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package csp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookReporter(t *testing.T) {
+
+	t.Run("Forwards reports", func(t *testing.T) {
+		received := Report{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			json.NewDecoder(r.Body).Decode(&received)
+		}))
+		defer srv.Close()
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		h := RouteHandler(NewWebhookReporter(srv.URL, nil))
+
+		h(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "http://example.com/css/style.css", received.BlockedURI)
+	})
+
+	t.Run("Returns delivery errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		wh := NewWebhookReporter(srv.URL, srv.Client())
+		err := wh.Report(Report{})
+		require.NotNil(t, err)
+		assert.EqualError(t, err, "Webhook request failed (status 502)")
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(reportString)))
+		req.Header.Set("Content-Type", ReportContentType)
+		rw := httptest.NewRecorder()
+
+		RouteHandler(wh)(rw, req)
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+	})
+
+	t.Run("Ignores delivery errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		wh := NewWebhookReporter(srv.URL, nil)
+		wh.IgnoreErrors = true
+		assert.Nil(t, wh.Report(Report{}))
+	})
+}